@@ -1,9 +1,12 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"strings"
 
 	"github.com/wilsonelectronics/productsapi/cache"
 )
@@ -57,3 +60,19 @@ func SetTokenData(handle string, r *http.Request) error {
 	err = cache.Store(handle, body)
 	return err
 }
+
+// IsAuthorized reports whether the request carries the bearer token required by the write endpoints.
+// The token is read from the API_WRITE_TOKEN environment variable; when it is unset nothing is authorized.
+func IsAuthorized(r *http.Request) bool {
+	expected := os.Getenv("API_WRITE_TOKEN")
+	if expected == "" {
+		return false
+	}
+
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
@@ -2,11 +2,16 @@ package blog
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"time"
+
+	"github.com/wilsonelectronics/productsapi/cache"
 )
 
 const (
@@ -14,6 +19,12 @@ const (
 	baseTopicURL = "https://api.hubapi.com/blogs/v3/topics?hapikey="
 )
 
+const publishedPostsPageSize = 300
+
+// CacheTTL is how long HubSpot blog content is cached. Posts are published a few times a week, and
+// caching keeps page views from using up the HubSpot API's daily call limit.
+const CacheTTL = 5 * time.Minute
+
 type request struct {
 	URL    string
 	Method string
@@ -81,6 +92,12 @@ type identityProfiles struct {
 	Identities              []interface{} `json:"identities"`
 }
 
+// PublishedPost . . .
+type PublishedPost struct {
+	Slug        string `json:"slug"`
+	PublishDate int64  `json:"publishDate"`
+}
+
 // singlePostResponseModel . . .
 type singlePostResponseModel struct {
 	Objects []*postData `json:"objects"`
@@ -213,7 +230,7 @@ func GetPostData(postSlug string) (*PageResponseModel, error) {
 // GetPostsWithTopicID . . .
 func GetPostsWithTopicID(topicSlugString string) (*TopicPostsResponseModel, error) {
 	var response TopicPostsResponseModel
-	topicsResp, err := http.Get(fmt.Sprintf("%s%s&slug=%s&property=id&property=name&property=slug", baseTopicURL, os.Getenv("hubSpotAPI"), topicSlugString))
+	topics, err := getCached(fmt.Sprintf("%s%s&slug=%s&property=id&property=name&property=slug", baseTopicURL, os.Getenv("hubSpotAPI"), topicSlugString))
 	if err != nil {
 		return nil, err
 	}
@@ -221,7 +238,7 @@ func GetPostsWithTopicID(topicSlugString string) (*TopicPostsResponseModel, erro
 	var topicsBody struct {
 		Objects []topicData `json:"objects"`
 	}
-	err = json.NewDecoder(topicsResp.Body).Decode(&topicsBody)
+	err = json.Unmarshal(topics, &topicsBody)
 	if err != nil {
 		return nil, err
 	}
@@ -231,7 +248,7 @@ func GetPostsWithTopicID(topicSlugString string) (*TopicPostsResponseModel, erro
 	}
 	response.Topic = topicsBody.Objects[0]
 
-	blogPostsResp, err := http.Get(fmt.Sprintf("%s%s&topic_id=%d&property=id&property=name&property=topic_ids&property=featured_image&property=publish_date&property=slug", baseBlogURL, os.Getenv("hubSpotAPI"), response.Topic.ID))
+	blogPosts, err := getCached(fmt.Sprintf("%s%s&topic_id=%d&property=id&property=name&property=topic_ids&property=featured_image&property=publish_date&property=slug", baseBlogURL, os.Getenv("hubSpotAPI"), response.Topic.ID))
 	if err != nil {
 		return nil, err
 	}
@@ -239,7 +256,7 @@ func GetPostsWithTopicID(topicSlugString string) (*TopicPostsResponseModel, erro
 	var blogPostsBody struct {
 		Objects topicPostData `json:"objects"`
 	}
-	if err := json.NewDecoder(blogPostsResp.Body).Decode(&blogPostsBody); err != nil {
+	if err := json.Unmarshal(blogPosts, &blogPostsBody); err != nil {
 		return nil, err
 	}
 	response.Posts = blogPostsBody.Objects
@@ -249,9 +266,7 @@ func GetPostsWithTopicID(topicSlugString string) (*TopicPostsResponseModel, erro
 
 // GetTwoCaseStudies . . .
 func GetTwoCaseStudies() (*CaseStudiesResponseModel, error) {
-	posts, err := doRequest(request{
-		URL:    fmt.Sprintf("%s%s&limit=2&property=id&property=name&property=topic_ids&property=featured_image&property=publish_date&property=slug&content_group_id=3708593652&state=published&topic_id=4126584798", baseBlogURL, os.Getenv("hubSpotAPI")),
-		Method: http.MethodGet})
+	posts, err := getCached(fmt.Sprintf("%s%s&limit=2&property=id&property=name&property=topic_ids&property=featured_image&property=publish_date&property=slug&content_group_id=3708593652&state=published&topic_id=4126584798", baseBlogURL, os.Getenv("hubSpotAPI")))
 	if err != nil {
 		return nil, err
 	}
@@ -261,9 +276,7 @@ func GetTwoCaseStudies() (*CaseStudiesResponseModel, error) {
 		return nil, err
 	}
 
-	topics, err := doRequest(request{
-		URL:    fmt.Sprintf("%s%s", baseTopicURL, os.Getenv("hubSpotAPI")),
-		Method: http.MethodGet})
+	topics, err := getCached(fmt.Sprintf("%s%s", baseTopicURL, os.Getenv("hubSpotAPI")))
 	if err != nil {
 		return nil, err
 	}
@@ -297,9 +310,7 @@ func GetTwoCaseStudies() (*CaseStudiesResponseModel, error) {
 
 // LoadMorePosts . . .
 func LoadMorePosts(offset int) (*LoadMorePostsResponseModel, error) {
-	posts, err := doRequest(request{
-		URL:    fmt.Sprintf("%s%s&limit=3&offset=%d&archived=false&property=id&property=html_title&property=post_summary&property=publish_date&property=topic_ids&property=slug&property=featured_image", baseBlogURL, os.Getenv("hubSpotAPI"), offset),
-		Method: http.MethodGet})
+	posts, err := getCached(fmt.Sprintf("%s%s&limit=3&offset=%d&archived=false&property=id&property=html_title&property=post_summary&property=publish_date&property=topic_ids&property=slug&property=featured_image", baseBlogURL, os.Getenv("hubSpotAPI"), offset))
 	if err != nil {
 		return nil, err
 	}
@@ -325,34 +336,77 @@ func GetHubSpotCookies(hubSpotUTK string) (*HubSpotCookieResponseModel, error) {
 	return cookiesData, err
 }
 
+// GetAllPublishedPosts pages through every published post, returning only slug and publish date.
+func GetAllPublishedPosts() ([]*PublishedPost, error) {
+	posts := []*PublishedPost{}
+	for offset := 0; ; {
+		page, err := getCached(fmt.Sprintf("%s%s&limit=%d&offset=%d&archived=false&property=slug&property=publish_date", baseBlogURL, os.Getenv("hubSpotAPI"), publishedPostsPageSize, offset))
+		if err != nil {
+			return nil, err
+		}
+
+		var pData postResponseModel
+		if err = json.Unmarshal(page, &pData); err != nil {
+			return nil, err
+		}
+
+		for _, p := range pData.Objects {
+			posts = append(posts, &PublishedPost{Slug: p.Slug, PublishDate: int64(p.PublishDate)})
+		}
+
+		offset += len(pData.Objects)
+		if len(pData.Objects) == 0 || offset >= pData.Total {
+			return posts, nil
+		}
+	}
+}
+
 func getTopic(slugID int) ([]byte, error) {
-	return doRequest(request{
-		URL:    fmt.Sprintf("https://api.hubapi.com/blogs/v3/topics/%d?hapikey=%s&property=slug", slugID, os.Getenv("hubSpotAPI")),
-		Method: http.MethodGet})
+	return getCached(fmt.Sprintf("https://api.hubapi.com/blogs/v3/topics/%d?hapikey=%s&property=slug", slugID, os.Getenv("hubSpotAPI")))
 }
 
 func getTopics() ([]byte, error) {
-	return doRequest(request{
-		URL:    fmt.Sprintf("%s%s", baseTopicURL, os.Getenv("hubSpotAPI")),
-		Method: http.MethodGet})
+	return getCached(fmt.Sprintf("%s%s", baseTopicURL, os.Getenv("hubSpotAPI")))
 }
 
 func getPost(slug string) ([]byte, error) {
-	return doRequest(request{
-		URL:    fmt.Sprintf("%s%s&slug=%s&archived=false&property=featured_image&property=name&property=slug&property=html_title&property=meta_description&property=publish_date&property=post_body&property=blog_author&property=topic_ids", baseBlogURL, os.Getenv("hubSpotAPI"), slug),
-		Method: http.MethodGet})
+	return getCached(fmt.Sprintf("%s%s&slug=%s&archived=false&property=featured_image&property=name&property=slug&property=html_title&property=meta_description&property=publish_date&property=post_body&property=blog_author&property=topic_ids", baseBlogURL, os.Getenv("hubSpotAPI"), slug))
 }
 
 func getPosts() ([]byte, error) {
-	return doRequest(request{
-		URL:    fmt.Sprintf("%s%s&limit=6&archived=false&property=id&property=html_title&property=name&property=post_summary&property=publish_date&property=topic_ids&property=slug&property=featured_image", baseBlogURL, os.Getenv("hubSpotAPI")),
-		Method: http.MethodGet})
+	return getCached(fmt.Sprintf("%s%s&limit=6&archived=false&property=id&property=html_title&property=name&property=post_summary&property=publish_date&property=topic_ids&property=slug&property=featured_image", baseBlogURL, os.Getenv("hubSpotAPI")))
 }
 
 func getFeaturedPosts() ([]byte, error) {
-	return doRequest(request{
-		URL:    fmt.Sprintf("%s%s&limit=3&archived=false&property=id&property=html_title&property=name&property=slug&property=featured_image", baseBlogURL, os.Getenv("hubSpotAPI")),
-		Method: http.MethodGet})
+	return getCached(fmt.Sprintf("%s%s&limit=3&archived=false&property=id&property=html_title&property=name&property=slug&property=featured_image", baseBlogURL, os.Getenv("hubSpotAPI")))
+}
+
+// getCached returns the body of a GET of url from the cache, or from HubSpot, caching it for CacheTTL when
+// HubSpot answers 200 OK. Keys are hashed so the API key in url is not stored in the cache.
+func getCached(url string) ([]byte, error) {
+	sum := sha256.Sum256([]byte(url))
+	key := "blog:" + hex.EncodeToString(sum[:])
+	body, err := cache.Retrieve(key)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		return body, nil
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if body, err = ioutil.ReadAll(resp.Body); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		cache.StoreFor(key, body, CacheTTL)
+	}
+	return body, nil
 }
 
 func doRequest(r request) ([]byte, error) {
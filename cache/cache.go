@@ -7,6 +7,20 @@ import (
 	"github.com/gomodule/redigo/redis"
 )
 
+// DefaultTTL is how long stored values live before they are reloaded from the database.
+const DefaultTTL = 60 * time.Second
+
+// Keys of values built from the whole catalog. They are kept longer than DefaultTTL, so the writes that change
+// them drop them too.
+const (
+	// MerchantFeedKey . . .
+	MerchantFeedKey = "merchantFeed"
+	// SitemapKey . . .
+	SitemapKey = "sitemap"
+	// ActiveProductsKey . . .
+	ActiveProductsKey = "activeProducts"
+)
+
 var pool = &redis.Pool{
 	MaxIdle:     10,
 	IdleTimeout: 240 * time.Second,
@@ -36,13 +50,42 @@ func Retrieve(key string) ([]byte, error) {
 	return redis.Bytes(conn.Do("GET", key))
 }
 
+// RetrieveMany returns the values of keys in order, nil for keys that are not cached.
+func RetrieveMany(keys ...string) ([][]byte, error) {
+	if len(keys) == 0 {
+		return [][]byte{}, nil
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	return redis.ByteSlices(conn.Do("MGET", redis.Args{}.AddFlat(keys)...))
+}
+
 // Store . . .
 func Store(key string, bytes []byte) error {
+	return StoreFor(key, bytes, DefaultTTL)
+}
+
+// StoreFor stores bytes under key for the given duration.
+func StoreFor(key string, bytes []byte, ttl time.Duration) error {
+	conn := pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SETEX", key, int(ttl.Seconds()), bytes)
+	return err
+}
+
+// Delete removes keys from the cache. Keys that are not cached are ignored.
+func Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
 	conn := pool.Get()
 	defer conn.Close()
 
-	secondsInDay := 60
-	_, err := conn.Do("SETEX", key, secondsInDay, bytes)
+	_, err := conn.Do("DEL", redis.Args{}.AddFlat(keys)...)
 	return err
 }
 
@@ -7,6 +7,11 @@ import (
 
 	"github.com/wilsonelectronics/productsapi/cache"
 	"github.com/wilsonelectronics/productsapi/data"
+	"github.com/wilsonelectronics/productsapi/inventory"
+	"github.com/wilsonelectronics/productsapi/money"
+	"github.com/wilsonelectronics/productsapi/product"
+	"github.com/wilsonelectronics/productsapi/rendition"
+	"github.com/wilsonelectronics/productsapi/spec"
 
 	"github.com/piotrkowalczuk/ntypes"
 )
@@ -19,6 +24,8 @@ type Category struct {
 	HeaderText  ntypes.String `json:"headerText"`
 	Description string        `json:"description"`
 	ImageURL    ntypes.String `json:"imageURL"`
+	// MembershipModifiedTime is when a product was last added to or removed from the category.
+	MembershipModifiedTime ntypes.String `json:"membershipModifiedTime"`
 }
 
 // Product . . .
@@ -32,14 +39,18 @@ type Product struct {
 	Title            string        `json:"title"`
 	TitleTag         ntypes.String `json:"titleTag"`
 	BodyHTML         ntypes.String `json:"bodyHtml"`
-	Price            float64       `json:"price"`
-	ImageURL         string        `json:"imageURL"`
-	Handle           string        `json:"handle"`
-	ModifiedTime     string        `json:"modifiedTime"`
-	IsActive         bool          `json:"isActive"`
-	IsDeleted        bool          `json:"isDeleted"`
-	Tags             []*tag        `json:"tags"`
-	OrderID          int           `json:"orderId"`
+	money.Price
+	ImageURL       string                  `json:"imageURL"`
+	ImageSet       *rendition.Set          `json:"imageSet,omitempty"`
+	Availability   *inventory.Availability `json:"availability,omitempty"`
+	Handle         string                  `json:"handle"`
+	ModifiedTime   string                  `json:"modifiedTime"`
+	IsActive       bool                    `json:"isActive"`
+	IsDeleted      bool                    `json:"isDeleted"`
+	Tags           []*tag                  `json:"tags"`
+	Specifications []*specification        `json:"specifications,omitempty"`
+	Variants       []*product.Variant      `json:"variants,omitempty"`
+	OrderID        int                     `json:"orderId"`
 }
 
 type productTag struct {
@@ -56,6 +67,15 @@ type tag struct {
 	IsActive bool   `json:"isActive"`
 }
 
+type specification struct {
+	ProductGUID        string      `json:"-"`
+	SpecificationID    int         `json:"specificationId"`
+	SpecificationLabel string      `json:"specificationLabel"`
+	FieldValue         string      `json:"specificationValue"`
+	IsActive           bool        `json:"isActive"`
+	Value              *spec.Value `json:"value,omitempty"`
+}
+
 // GetAll . . .
 func GetAll() ([]*Category, error) {
 	bytes, err := cache.Retrieve("categories")
@@ -83,6 +103,21 @@ func GetAll() ([]*Category, error) {
 	return categories, err
 }
 
+// MembershipModifiedTime returns when a product was last added to or removed from the category with
+// categoryGUID, or "" when that is not known.
+func MembershipModifiedTime(categoryGUID string) (string, error) {
+	categories, err := GetAll()
+	if err != nil {
+		return "", err
+	}
+	for _, c := range categories {
+		if strings.EqualFold(c.GUID, categoryGUID) {
+			return c.MembershipModifiedTime.StringOr(""), nil
+		}
+	}
+	return "", nil
+}
+
 // GetProducts . . .
 func GetProducts(categoryGUID string) ([]*Product, error) {
 	bytes, err := cache.Retrieve(categoryGUID)
@@ -97,6 +132,26 @@ func GetProducts(categoryGUID string) ([]*Product, error) {
 			return nil, err
 		}
 
+		if err = getAndSetTagsForProducts(categoryGUID, products); err != nil {
+			return nil, err
+		}
+
+		if err = getAndSetSpecificationsForProducts(categoryGUID, products); err != nil {
+			return nil, err
+		}
+
+		productGUIDs := []string{}
+		for _, p := range products {
+			productGUIDs = append(productGUIDs, p.GUID)
+		}
+		variants, err := product.GetActiveVariants(productGUIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range products {
+			p.Variants = variants[p.GUID]
+		}
+
 		productsJSON, err := json.Marshal(products)
 		if err != nil {
 			return nil, err
@@ -132,7 +187,8 @@ func getAllFromDbAndCache() ([]*Category, error) {
 			&category.Handle,
 			&category.HeaderText,
 			&category.Description,
-			&category.ImageURL); err != nil {
+			&category.ImageURL,
+			&category.MembershipModifiedTime); err != nil {
 			return nil, fmt.Errorf("Error in spcCategoryGet: %s", err)
 		}
 		categories = append(categories, category)
@@ -181,34 +237,30 @@ func getProductsFromDb(categoryGUID string) (products []*Product, err error) {
 	return products, err
 }
 
-func getAndSetTagsForProducts(products []*Product) error {
-	productGUIDs := []string{}
-	for _, p := range products {
-		productGUIDs = append(productGUIDs, p.GUID)
-	}
-
+// getAndSetTagsForProducts loads the tags of every product of a category in one query.
+func getAndSetTagsForProducts(categoryGUID string, products []*Product) error {
 	db, err := data.GetDB()
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
-	rows, err := db.Query("set nocount on; exec [spcProductTagsGet] ?", strings.Join(productGUIDs, ","))
+	rows, err := db.Query("set nocount on; exec [spcCategoryProductTagsGet] ?", categoryGUID)
 	if err != nil {
-		return fmt.Errorf("Error in spcProductTagsGet: %s", err)
+		return fmt.Errorf("Error in spcCategoryProductTagsGet: %s", err)
 	}
 	defer rows.Close()
 
 	productTags := []*productTag{}
 	for rows.Next() {
 		productTag := &productTag{}
-		if rows.Scan(
+		if err = rows.Scan(
 			&productTag.ProductTagGUID,
 			&productTag.ProductGUID,
 			&productTag.TagID,
 			&productTag.TagName,
 			&productTag.IsActive); err != nil {
-			return fmt.Errorf("Error in spcProductTagsGet Scan: %s", err)
+			return fmt.Errorf("Error in spcCategoryProductTagsGet Scan: %s", err)
 		}
 
 		productTags = append(productTags, productTag)
@@ -227,3 +279,50 @@ func getAndSetTagsForProducts(products []*Product) error {
 
 	return nil
 }
+
+// getAndSetSpecificationsForProducts loads the specifications of every product of a category in one query.
+func getAndSetSpecificationsForProducts(categoryGUID string, products []*Product) error {
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("set nocount on; exec [spcCategoryProductSpecificationsGet] ?", categoryGUID)
+	if err != nil {
+		return fmt.Errorf("Error in spcCategoryProductSpecificationsGet: %s", err)
+	}
+	defer rows.Close()
+
+	productSpecifications := []*specification{}
+	for rows.Next() {
+		var guid string
+		s := &specification{}
+		if err = rows.Scan(
+			&guid,
+			&s.ProductGUID,
+			&s.SpecificationID,
+			&s.FieldValue,
+			&s.IsActive,
+			&s.SpecificationLabel); err != nil {
+			return fmt.Errorf("Error in spcCategoryProductSpecificationsGet Scan: %s", err)
+		}
+
+		productSpecifications = append(productSpecifications, s)
+	}
+
+	schema, err := spec.GetSchema()
+	if err != nil {
+		return err
+	}
+	for _, p := range products {
+		for _, s := range productSpecifications {
+			if s.ProductGUID == p.GUID && s.IsActive {
+				s.Value = schema.Type(p.ProductTypeID, s.SpecificationID, s.FieldValue)
+				p.Specifications = append(p.Specifications, s)
+			}
+		}
+	}
+
+	return nil
+}
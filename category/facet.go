@@ -0,0 +1,411 @@
+package category
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/cache"
+	"github.com/wilsonelectronics/productsapi/data"
+	"github.com/wilsonelectronics/productsapi/inventory"
+	"github.com/wilsonelectronics/productsapi/locale"
+	"github.com/wilsonelectronics/productsapi/money"
+	"github.com/wilsonelectronics/productsapi/pricelist"
+	"github.com/wilsonelectronics/productsapi/rendition"
+	"github.com/wilsonelectronics/productsapi/strslice"
+)
+
+const (
+	priceFacet       = "price"
+	tagFacet         = "tag"
+	productTypeFacet = "productType"
+	specFacetPrefix  = "spec."
+)
+
+// FacetSpecifications lists the specification labels offered as facets on category product lists.
+var FacetSpecifications = []string{"Frequency Bands", "Gain"}
+
+type priceBucket struct {
+	Min float64
+	Max float64
+}
+
+var rangeSelectionPattern = regexp.MustCompile(`^(-?\d+(?:\.\d+)?)?\s*-\s*(-?\d+(?:\.\d+)?)?$`)
+
+// priceBuckets holds the price facet ranges of each currency, in whole amounts of the currency. The CAD
+// ranges are the USD ones converted and rounded, so both lists split the catalog about the same way.
+var priceBuckets = map[string][]priceBucket{
+	money.USD: {
+		{Min: 0, Max: 250},
+		{Min: 250, Max: 500},
+		{Min: 500, Max: 1000},
+		{Min: 1000},
+	},
+	money.CAD: {
+		{Min: 0, Max: 350},
+		{Min: 350, Max: 700},
+		{Min: 700, Max: 1400},
+		{Min: 1400},
+	},
+}
+
+// ProductList . . .
+type ProductList struct {
+	Products []*Product `json:"products"`
+	Facets   []*Facet   `json:"facets"`
+}
+
+// Facet . . .
+type Facet struct {
+	Name   string        `json:"name"`
+	Label  string        `json:"label"`
+	Values []*FacetValue `json:"values"`
+}
+
+// FacetValue . . .
+type FacetValue struct {
+	Value    string `json:"value"`
+	Label    string `json:"label"`
+	Count    int    `json:"count"`
+	Selected bool   `json:"selected"`
+
+	// lowest is the lowest amount of a price bucket or a number or range specification value, which such values
+	// sort by.
+	lowest *float64
+}
+
+// FacetSelections maps a facet name to the values selected for it. Values of one facet are
+// OR'd together and different facets are AND'd.
+type FacetSelections map[string][]string
+
+// values returns the values selected for the facet name. Facet names are matched case insensitively, as
+// specification labels are when filtering.
+func (s FacetSelections) values(name string) []string {
+	values := []string{}
+	for key, selected := range s {
+		if strings.EqualFold(key, name) {
+			values = append(values, selected...)
+		}
+	}
+	return values
+}
+
+type productType struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// SelectionsFromQuery reads facet selections from query parameters. Values may be repeated or comma separated,
+// e.g. ?tag=3,7&price=0-250&spec.Gain=72 dB. Specifications typed as numbers or ranges can also be selected by
+// a range of their normalized unit, e.g. spec.Gain=65- or spec.Coverage Area=2000-5000.
+func SelectionsFromQuery(query url.Values) FacetSelections {
+	selections := FacetSelections{}
+	for key, values := range query {
+		if key != priceFacet && key != tagFacet && key != productTypeFacet && !strings.HasPrefix(key, specFacetPrefix) {
+			continue
+		}
+		for _, v := range values {
+			for _, s := range strings.Split(v, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					selections[key] = append(selections[key], s)
+				}
+			}
+		}
+	}
+	return selections
+}
+
+// GetProductsWithFacets returns the products of a category matching selections, along with facet counts.
+// Each facet is counted against the products matching every other facet's selections, so unselected
+// values of a facet show how many products selecting them would add. Prices, and so the price facet, come
+// from the price list in currency. Selections name specifications by their locale.Default label, while the
+// products and facet labels returned are in loc.
+func GetProductsWithFacets(categoryGUID string, selections FacetSelections, currency string, loc string) (*ProductList, error) {
+	products, err := GetProducts(categoryGUID)
+	if err != nil {
+		return nil, err
+	}
+
+	prices, err := pricelist.Get(currency)
+	if err != nil {
+		return nil, err
+	}
+	skus := []string{}
+	for _, p := range products {
+		skus = append(skus, p.SKU)
+		for _, v := range p.Variants {
+			skus = append(skus, v.SKU)
+		}
+	}
+	inv, err := inventory.Get(skus...)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range products {
+		for _, v := range p.Variants {
+			v.Price = prices.VariantPrice(p.GUID, p.Price, v.Price)
+			v.ImageSet = rendition.For(v.ImageURL)
+			v.Availability = inv.Summary(v.SKU)
+		}
+		p.Price = prices.Price(p.GUID, p.Price)
+		p.ImageSet = rendition.For(p.ImageURL)
+		p.Availability = inv.Summary(p.SKU)
+	}
+
+	productTypes, err := getProductTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{priceFacet, tagFacet, productTypeFacet}
+	for _, label := range FacetSpecifications {
+		names = append(names, specFacetPrefix+label)
+	}
+
+	list := &ProductList{Products: []*Product{}, Facets: []*Facet{}}
+	for _, p := range products {
+		if matchesSelections(p, selections, "") {
+			list.Products = append(list.Products, p)
+		}
+	}
+
+	for _, name := range names {
+		facet := &Facet{Name: name, Label: facetLabel(name), Values: []*FacetValue{}}
+		counts := map[string]*FacetValue{}
+		for _, p := range products {
+			if !matchesSelections(p, selections, name) {
+				continue
+			}
+			for _, v := range facetValues(p, name, productTypes) {
+				fv, ok := counts[v.Value]
+				if !ok {
+					fv = v
+					fv.Selected = strslice.Contains(selections.values(name), v.Value)
+					counts[v.Value] = fv
+					facet.Values = append(facet.Values, fv)
+				}
+				fv.Count++
+			}
+		}
+		sort.SliceStable(facet.Values, func(i, j int) bool {
+			a, b := facet.Values[i], facet.Values[j]
+			if a.lowest != nil && b.lowest != nil && *a.lowest != *b.lowest {
+				return *a.lowest < *b.lowest
+			}
+			return a.Label < b.Label
+		})
+		list.Facets = append(list.Facets, facet)
+	}
+
+	t, err := locale.Get(loc)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range list.Facets {
+		if strings.HasPrefix(f.Name, specFacetPrefix) {
+			f.Label = specificationLabel(products, f.Label, t)
+		}
+	}
+	localize(products, t)
+
+	return list, nil
+}
+
+func matchesSelections(p *Product, selections FacetSelections, skip string) bool {
+	for name, selected := range selections {
+		if strings.EqualFold(name, skip) || len(selected) == 0 {
+			continue
+		}
+		matched := false
+		for _, v := range facetValues(p, name, nil) {
+			if strslice.Contains(selected, v.Value) {
+				matched = true
+				break
+			}
+		}
+		if !matched && strings.HasPrefix(name, specFacetPrefix) {
+			matched = matchesSpecificationRange(p, strings.TrimPrefix(name, specFacetPrefix), selected)
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func facetValues(p *Product, name string, productTypes map[int]string) []*FacetValue {
+	switch {
+	case name == priceFacet:
+		currency := p.Price.Money().Currency()
+		for _, b := range priceBuckets[currency] {
+			if b.contains(p.Price.Money()) {
+				lowest := b.Min
+				return []*FacetValue{{Value: b.value(), Label: b.label(currency), lowest: &lowest}}
+			}
+		}
+	case name == tagFacet:
+		values := []*FacetValue{}
+		for _, t := range p.Tags {
+			if t.IsActive {
+				values = append(values, &FacetValue{Value: strconv.Itoa(t.ID), Label: t.Name})
+			}
+		}
+		return values
+	case name == productTypeFacet:
+		id := strconv.Itoa(p.ProductTypeID)
+		label, ok := productTypes[p.ProductTypeID]
+		if !ok {
+			label = id
+		}
+		return []*FacetValue{{Value: id, Label: label}}
+	case strings.HasPrefix(name, specFacetPrefix):
+		label := strings.TrimPrefix(name, specFacetPrefix)
+		values := []*FacetValue{}
+		for _, s := range p.Specifications {
+			if !strings.EqualFold(s.SpecificationLabel, label) || s.FieldValue == "" {
+				continue
+			}
+			// Numbers and ranges are listed in their normalized form, so "72dB" and "72 dB" are one value.
+			if lowest, _, ok := s.Value.Bounds(); ok {
+				normalized := s.Value.String()
+				values = append(values, &FacetValue{Value: normalized, Label: normalized, lowest: &lowest})
+			} else {
+				values = append(values, &FacetValue{Value: s.FieldValue, Label: s.FieldValue})
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// matchesSpecificationRange reports whether a number or range specification of p with label falls in, or for
+// ranges overlaps, one of the selected ranges.
+func matchesSpecificationRange(p *Product, label string, selected []string) bool {
+	for _, s := range p.Specifications {
+		if !strings.EqualFold(s.SpecificationLabel, label) {
+			continue
+		}
+		lowest, highest, ok := s.Value.Bounds()
+		if !ok {
+			continue
+		}
+		for _, selection := range selected {
+			min, max, ok := parseRangeSelection(selection)
+			if ok && (min == nil || highest >= *min) && (max == nil || lowest <= *max) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseRangeSelection reads a selected range such as "65-80", "65-" (65 or more) or "-80" (up to 80).
+func parseRangeSelection(selection string) (*float64, *float64, bool) {
+	m := rangeSelectionPattern.FindStringSubmatch(strings.TrimSpace(selection))
+	if m == nil || (m[1] == "" && m[2] == "") {
+		return nil, nil, false
+	}
+	bounds := make([]*float64, 2)
+	for i, s := range m[1:] {
+		if s == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, nil, false
+		}
+		bounds[i] = &n
+	}
+	return bounds[0], bounds[1], true
+}
+
+func facetLabel(name string) string {
+	switch name {
+	case priceFacet:
+		return "Price"
+	case tagFacet:
+		return "Tags"
+	case productTypeFacet:
+		return "Product Type"
+	}
+	return strings.TrimPrefix(name, specFacetPrefix)
+}
+
+func (b priceBucket) contains(price money.Money) bool {
+	if price.Less(money.FromFloat(b.Min, price.Currency())) {
+		return false
+	}
+	return b.Max == 0 || price.Less(money.FromFloat(b.Max, price.Currency()))
+}
+
+func (b priceBucket) value() string {
+	if b.Max == 0 {
+		return fmt.Sprintf("%g-", b.Min)
+	}
+	return fmt.Sprintf("%g-%g", b.Min, b.Max)
+}
+
+func (b priceBucket) label(currency string) string {
+	if b.Max == 0 {
+		return fmt.Sprintf("%g+ %s", b.Min, currency)
+	}
+	return fmt.Sprintf("%g - %g %s", b.Min, b.Max, currency)
+}
+
+func getProductTypes() (map[int]string, error) {
+	productTypes := []*productType{}
+	bytes, err := cache.Retrieve("productTypes")
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes == nil {
+		if productTypes, err = getProductTypesFromDb(); err != nil {
+			return nil, err
+		}
+
+		productTypesJSON, err := json.Marshal(productTypes)
+		if err != nil {
+			return nil, err
+		}
+
+		cache.Store("productTypes", productTypesJSON)
+	} else if err = json.Unmarshal(bytes, &productTypes); err != nil {
+		return nil, err
+	}
+
+	names := map[int]string{}
+	for _, t := range productTypes {
+		names[t.ID] = t.Name
+	}
+	return names, nil
+}
+
+func getProductTypesFromDb() ([]*productType, error) {
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("set nocount on; exec [spcProductTypesGet]")
+	if err != nil {
+		return nil, fmt.Errorf("Error in spcProductTypesGet: %s", err)
+	}
+	defer rows.Close()
+
+	productTypes := []*productType{}
+	for rows.Next() {
+		t := &productType{}
+		if err = rows.Scan(&t.ID, &t.Name); err != nil {
+			return nil, fmt.Errorf("Error in spcProductTypesGet Scan: %s", err)
+		}
+		productTypes = append(productTypes, t)
+	}
+
+	return productTypes, nil
+}
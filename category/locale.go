@@ -0,0 +1,37 @@
+package category
+
+import "github.com/wilsonelectronics/productsapi/locale"
+
+// localize replaces the text fields and specification labels of products with their translations in t.
+func localize(products []*Product, t *locale.Translations) {
+	for _, p := range products {
+		texts := t.Product(p.GUID)
+		if texts.Title.Valid {
+			p.Title = texts.Title.Chars
+		}
+		if texts.Description.Valid {
+			p.Description = texts.Description.Chars
+		}
+		if texts.DescriptionShort.Valid {
+			p.DescriptionShort = texts.DescriptionShort
+		}
+		if texts.BodyHTML.Valid {
+			p.BodyHTML = texts.BodyHTML
+		}
+		for _, s := range p.Specifications {
+			s.SpecificationLabel = t.SpecificationLabel(s.SpecificationID, s.SpecificationLabel)
+		}
+	}
+}
+
+// specificationLabel translates the label of a specification facet, finding its ID among the products.
+func specificationLabel(products []*Product, label string, t *locale.Translations) string {
+	for _, p := range products {
+		for _, s := range p.Specifications {
+			if s.SpecificationLabel == label {
+				return t.SpecificationLabel(s.SpecificationID, label)
+			}
+		}
+	}
+	return label
+}
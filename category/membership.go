@@ -0,0 +1,75 @@
+package category
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/wilsonelectronics/productsapi/cache"
+	"github.com/wilsonelectronics/productsapi/changefeed"
+	"github.com/wilsonelectronics/productsapi/data"
+)
+
+// ErrNotFound is returned when the category or product does not exist.
+var ErrNotFound = errors.New("category or product not found")
+
+// AddProduct . . .
+func AddProduct(categoryGUID, productHandle string) error {
+	return setMembership(categoryGUID, productHandle, true)
+}
+
+// RemoveProduct . . .
+func RemoveProduct(categoryGUID, productHandle string) error {
+	return setMembership(categoryGUID, productHandle, false)
+}
+
+func setMembership(categoryGUID, productHandle string, member bool) error {
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	proc := "spcCategoryProductDelete"
+	if member {
+		proc = "spcCategoryProductInsert"
+	}
+
+	// The procedures return the product's GUID and whether membership actually changed.
+	var productGUID string
+	var changed bool
+	err = tx.QueryRow(fmt.Sprintf("set nocount on; exec [%s] ?, ?", proc), categoryGUID, productHandle).Scan(&productGUID, &changed)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("Error in %s: %s", proc, err)
+	}
+
+	if changed {
+		change := &changefeed.Change{Field: "categories", New: categoryGUID}
+		if !member {
+			change = &changefeed.Change{Field: "categories", Old: categoryGUID}
+		}
+		if err = changefeed.Record(tx, &changefeed.Event{
+			Type:        changefeed.CategoryMembershipChanged,
+			ProductGUID: productGUID,
+			Handle:      productHandle,
+			Changes:     []*changefeed.Change{change}}); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	// The category list carries the membership modified time.
+	cache.Delete(categoryGUID, "categories")
+	return nil
+}
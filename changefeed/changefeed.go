@@ -0,0 +1,119 @@
+package changefeed
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/wilsonelectronics/productsapi/data"
+)
+
+const (
+	// ProductCreated . . .
+	ProductCreated = "product.created"
+	// ProductUpdated . . .
+	ProductUpdated = "product.updated"
+	// ProductDeleted . . .
+	ProductDeleted = "product.deleted"
+	// CategoryMembershipChanged is recorded when a product is added to or removed from a category.
+	CategoryMembershipChanged = "category.membershipChanged"
+
+	// MaxLimit is the most events returned by one call to Since.
+	MaxLimit = 1000
+)
+
+// Change . . .
+type Change struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// Event records one change to a product. Position is the event's rowversion, which is taken when the event
+// is written rather than when its transaction commits, so events are only read once no open transaction can
+// still commit an earlier position (see Since). The Position of the last event a consumer processed is the
+// cursor to resume from.
+type Event struct {
+	ID          int64     `json:"id"`
+	Position    int64     `json:"position"`
+	Type        string    `json:"type"`
+	ProductGUID string    `json:"productGuid"`
+	Handle      string    `json:"handle"`
+	Changes     []*Change `json:"changes"`
+	CreatedTime string    `json:"createdTime"`
+}
+
+// Page . . .
+type Page struct {
+	Events     []*Event `json:"events"`
+	NextCursor int64    `json:"nextCursor"`
+	HasMore    bool     `json:"hasMore"`
+}
+
+// Record stores e as part of tx, so it only becomes visible if the change it describes is committed.
+func Record(tx *sql.Tx, e *Event) error {
+	changesJSON, err := json.Marshal(e.Changes)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.QueryRow("set nocount on; exec [spcProductChangeInsert] ?, ?, ?, ?",
+		e.Type,
+		e.ProductGUID,
+		e.Handle,
+		string(changesJSON)).Scan(&e.ID, &e.CreatedTime); err != nil {
+		return fmt.Errorf("spcProductChangeInsert failed: %s", err)
+	}
+	return nil
+}
+
+// Since returns up to limit committed events with a Position after cursor, in Position order. A cursor of 0
+// starts from the oldest event still kept. spcProductChangesGet only returns positions below
+// MIN_ACTIVE_ROWVERSION(), holding back events that follow one in a still open transaction, so an event that
+// commits late is not skipped by a cursor that has already moved past its ID.
+func Since(cursor int64, limit int) (*Page, error) {
+	if limit <= 0 || limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// One extra row tells whether there is more to read.
+	rows, err := db.Query("set nocount on; exec [spcProductChangesGet] ?, ?", cursor, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("spcProductChangesGet Query failed: %s", err)
+	}
+	defer rows.Close()
+
+	page := &Page{Events: []*Event{}, NextCursor: cursor}
+	for rows.Next() {
+		e := &Event{}
+		var changesJSON string
+		if err = rows.Scan(
+			&e.ID,
+			&e.Position,
+			&e.Type,
+			&e.ProductGUID,
+			&e.Handle,
+			&changesJSON,
+			&e.CreatedTime); err != nil {
+			return nil, fmt.Errorf("spcProductChangesGet Query Scan failed: %s", err)
+		}
+		if err = json.Unmarshal([]byte(changesJSON), &e.Changes); err != nil {
+			return nil, fmt.Errorf("could not read changes of event %d: %s", e.ID, err)
+		}
+
+		if len(page.Events) == limit {
+			page.HasMore = true
+			break
+		}
+		page.Events = append(page.Events, e)
+		page.NextCursor = e.Position
+	}
+
+	return page, nil
+}
@@ -0,0 +1,157 @@
+// Command catalog maintains the product catalog from files.
+//
+//	catalog import [-dry-run] products.csv|products.json
+//	catalog export [-format csv|jsonl|spreadsheet] [-columns handle,sku,price] [-o catalog.csv]
+//	catalog webhooks [-interval 30s]
+//	catalog prices [-interval 1m]
+//
+// It uses the same DBADDRESS and REDIS_URL environment variables as the API.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wilsonelectronics/productsapi/product"
+	"github.com/wilsonelectronics/productsapi/webhook"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = runImport(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	case "webhooks":
+		err = runWebhooks(os.Args[2:])
+	case "prices":
+		err = runPrices(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: catalog import [-dry-run] <file.csv|file.json>")
+	fmt.Fprintln(os.Stderr, "       catalog export [-format csv|jsonl|spreadsheet] [-columns a,b,c] [-o file]")
+	fmt.Fprintln(os.Stderr, "       catalog webhooks [-interval 30s]")
+	fmt.Fprintln(os.Stderr, "       catalog prices [-interval 1m]")
+	os.Exit(2)
+}
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "report the changes without writing them")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var rows []*product.ImportRow
+	if strings.EqualFold(filepath.Ext(f.Name()), ".csv") {
+		rows, err = product.ReadImportCSV(f)
+	} else {
+		rows, err = product.ReadImportJSON(f)
+	}
+	if err != nil {
+		return err
+	}
+
+	report, err := product.Import(rows, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(report); err != nil {
+		return err
+	}
+
+	if report.Invalid > 0 {
+		return fmt.Errorf("%d invalid rows, nothing was imported", report.Invalid)
+	}
+	return nil
+}
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", product.ExportCSV, "csv, jsonl or spreadsheet")
+	columns := flags.String("columns", "", "comma separated columns to write, all by default")
+	output := flags.String("o", "", "file to write, standard output by default")
+	flags.Parse(args)
+
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	selected := []string{}
+	for _, c := range strings.Split(*columns, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			selected = append(selected, c)
+		}
+	}
+
+	return product.Export(out, *format, selected)
+}
+
+// runWebhooks delivers webhooks until interrupted.
+func runWebhooks(args []string) error {
+	flags := flag.NewFlagSet("webhooks", flag.ExitOnError)
+	interval := flags.Duration("interval", 30*time.Second, "how often to look for new events and due deliveries")
+	flags.Parse(args)
+
+	webhook.Run(interruptible(), *interval)
+	return nil
+}
+
+// runPrices applies scheduled prices as they become due until interrupted.
+func runPrices(args []string) error {
+	flags := flag.NewFlagSet("prices", flag.ExitOnError)
+	interval := flags.Duration("interval", time.Minute, "how often to look for due scheduled prices")
+	flags.Parse(args)
+
+	product.RunScheduledPrices(interruptible(), *interval)
+	return nil
+}
+
+// interruptible returns a context that is cancelled on the first interrupt signal.
+func interruptible() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+	return ctx
+}
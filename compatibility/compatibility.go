@@ -0,0 +1,450 @@
+package compatibility
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/cache"
+	"github.com/wilsonelectronics/productsapi/data"
+	"github.com/wilsonelectronics/productsapi/locale"
+	"github.com/wilsonelectronics/productsapi/money"
+	"github.com/wilsonelectronics/productsapi/pricelist"
+	"github.com/wilsonelectronics/productsapi/product"
+	"github.com/wilsonelectronics/productsapi/strslice"
+)
+
+const (
+	// BandsSpecification is the specification listing the frequency bands a product boosts, e.g. "Band 2, 4, 5, 12/17".
+	BandsSpecification = "Frequency Bands"
+	// CarriersSpecification is the specification listing carriers a product is certified for, e.g. "Verizon, AT&T".
+	CarriersSpecification = "Carriers"
+	// UseCaseSpecification is the specification listing where a product is installed, e.g. "Home, Building".
+	UseCaseSpecification = "Use Case"
+
+	carriersCacheKey = "carriers"
+)
+
+// ErrInvalidQuery is returned for a query naming an unknown carrier, band or use case, or naming none at all.
+var ErrInvalidQuery = errors.New("invalid compatibility query")
+
+var (
+	// each of which may repeat the prefix: "Bands 2, 4, 5, and 12/17", "B2/B4/B5".
+	// each of which may repeat the prefix: "Bands 2, 4 and 12/17", "B2/B4/B5".
+	bandListPattern = regexp.MustCompile(`(?i)\b(?:bands?|b)\s*\d+(?:\s*(?:,?\s*\band\b|[,/&])\s*(?:(?:bands?|b)\s*)?\d+)*`)
+	digitsPattern   = regexp.MustCompile(`\d+`)
+	// Numbers followed by a unit or a decimal part are frequencies or generations, not bands.
+	notBandSuffix   = regexp.MustCompile(`(?i)^(?:\s*(?:g|mhz|ghz)|\.\d)`)
+	listSeparators  = regexp.MustCompile(`\s*[,;/|]\s*`)
+	bandPrefixTrims = []string{"band", "b"}
+)
+
+// UseCase is a kind of installation a product is made for.
+type UseCase struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+}
+
+// UseCases lists the use cases products can be looked up by.
+var UseCases = []*UseCase{
+	{Name: "home", Label: "Home"},
+	{Name: "vehicle", Label: "Vehicle"},
+	{Name: "building", Label: "Building"},
+}
+
+// Carrier is a wireless carrier and the bands it uses, in ascending order.
+type Carrier struct {
+	Name  string   `json:"name"`
+	Bands []string `json:"bands"`
+}
+
+// Query asks for products working with Carriers and Bands and made for UseCase. At least one must be set.
+type Query struct {
+	Carriers []string
+	Bands    []string
+	UseCase  string
+}
+
+// Match is a product matching a Query. Score is the share of the wanted bands and carriers the product
+// supports, from 0 to 1, and matches are ranked by it.
+type Match struct {
+	GUID   string `json:"guid"`
+	Handle string `json:"handle"`
+	SKU    string `json:"sku"`
+	Title  string `json:"title"`
+	money.Price
+	ImageURL     string           `json:"imageURL"`
+	Bands        []string         `json:"bands"`
+	UseCases     []string         `json:"useCases"`
+	MatchedBands []string         `json:"matchedBands"`
+	MissingBands []string         `json:"missingBands"`
+	Carriers     []*CarrierResult `json:"carriers"`
+	Score        float64          `json:"score"`
+}
+
+// CarrierResult tells whether a product works with a carrier: either it is certified for it, or it boosts
+// every band the carrier uses.
+type CarrierResult struct {
+	Name      string `json:"name"`
+	Supported bool   `json:"supported"`
+	Certified bool   `json:"certified"`
+}
+
+// entry is the compatibility of one active product, parsed from its specifications.
+type entry struct {
+	GUID   string `json:"guid"`
+	Handle string `json:"handle"`
+	SKU    string `json:"sku"`
+	Title  string `json:"title"`
+	money.Price
+	ImageURL string   `json:"imageURL"`
+	Bands    []string `json:"bands"`
+	Carriers []string `json:"carriers"`
+	UseCases []string `json:"useCases"`
+}
+
+// GetCarriers returns every carrier with its bands, by name.
+func GetCarriers() ([]*Carrier, error) {
+	bytes, err := cache.Retrieve(carriersCacheKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes == nil {
+		return getCarriersFromDbAndCache()
+	}
+
+	carriers := []*Carrier{}
+	err = json.Unmarshal(bytes, &carriers)
+	return carriers, err
+}
+
+// Find returns the active products matching q, best first, priced from the price list in currency and with
+// titles in loc.
+func Find(q *Query, currency string, loc string) ([]*Match, error) {
+	carriers, err := GetCarriers()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted, requested, useCase, err := resolve(q, carriers)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := getIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []*Match{}
+	for _, e := range entries {
+		if m := match(e, wanted, requested, useCase); m != nil {
+			matches = append(matches, m)
+		}
+	}
+
+	prices, err := pricelist.Get(currency)
+	if err != nil {
+		return nil, err
+	}
+	t, err := locale.Get(loc)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matches {
+		m.Price = prices.Price(m.GUID, m.Price)
+		if title := t.Product(m.GUID).Title; title.Valid {
+			m.Title = title.Chars
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		if len(matches[i].MatchedBands) != len(matches[j].MatchedBands) {
+			return len(matches[i].MatchedBands) > len(matches[j].MatchedBands)
+		}
+		return matches[i].Handle < matches[j].Handle
+	})
+
+	return matches, nil
+}
+
+// resolve checks q against the known carriers and use cases, returning the bands wanted (those asked for
+// and those of every carrier asked for), the carriers asked for and the use case.
+func resolve(q *Query, carriers []*Carrier) ([]string, []*Carrier, *UseCase, error) {
+	if q == nil || (len(q.Carriers) == 0 && len(q.Bands) == 0 && q.UseCase == "") {
+		return nil, nil, nil, fmt.Errorf("%w: give a carrier, band or use case", ErrInvalidQuery)
+	}
+
+	wanted := []string{}
+	for _, b := range q.Bands {
+		band := normalizeBand(b)
+		if band == "" {
+			return nil, nil, nil, fmt.Errorf("%w: %q is not a band number", ErrInvalidQuery, b)
+		}
+		wanted = appendUnique(wanted, band)
+	}
+
+	requested := []*Carrier{}
+	for _, name := range q.Carriers {
+		c := findCarrier(carriers, name)
+		if c == nil {
+			return nil, nil, nil, fmt.Errorf("%w: unknown carrier %q", ErrInvalidQuery, name)
+		}
+		requested = append(requested, c)
+		for _, band := range c.Bands {
+			wanted = appendUnique(wanted, band)
+		}
+	}
+
+	var useCase *UseCase
+	if q.UseCase != "" {
+		if useCase = findUseCase(q.UseCase); useCase == nil {
+			names := []string{}
+			for _, u := range UseCases {
+				names = append(names, u.Name)
+			}
+			return nil, nil, nil, fmt.Errorf("%w: use case must be one of %s", ErrInvalidQuery, strings.Join(names, ", "))
+		}
+	}
+
+	return sortBands(wanted), requested, useCase, nil
+}
+
+// match returns how e matches the wanted bands, requested carriers and use case, or nil when it is not made
+// for the use case or neither boosts a wanted band nor is certified for a requested carrier.
+func match(e *entry, wanted []string, requested []*Carrier, useCase *UseCase) *Match {
+	if useCase != nil && !strslice.ContainsFold(e.UseCases, useCase.Name) {
+		return nil
+	}
+
+	m := &Match{
+		GUID:         e.GUID,
+		Handle:       e.Handle,
+		SKU:          e.SKU,
+		Title:        e.Title,
+		Price:        e.Price,
+		ImageURL:     e.ImageURL,
+		Bands:        e.Bands,
+		UseCases:     e.UseCases,
+		MatchedBands: []string{},
+		MissingBands: []string{},
+		Carriers:     []*CarrierResult{},
+	}
+	for _, band := range wanted {
+		if strslice.Contains(e.Bands, band) {
+			m.MatchedBands = append(m.MatchedBands, band)
+		} else {
+			m.MissingBands = append(m.MissingBands, band)
+		}
+	}
+	supported := 0
+	for _, c := range requested {
+		r := &CarrierResult{Name: c.Name, Certified: strslice.ContainsFold(e.Carriers, c.Name), Supported: true}
+		for _, band := range c.Bands {
+			if !strslice.Contains(e.Bands, band) {
+				r.Supported = false
+				break
+			}
+		}
+		r.Supported = r.Supported || r.Certified
+		if r.Supported {
+			supported++
+		}
+		m.Carriers = append(m.Carriers, r)
+	}
+	if len(wanted) > 0 && len(m.MatchedBands) == 0 && supported == 0 {
+		return nil
+	}
+
+	m.Score = 1
+	if total := len(wanted) + len(requested); total > 0 {
+		m.Score = float64(len(m.MatchedBands)+supported) / float64(total)
+	}
+	return m
+}
+
+// getIndex parses the compatibility of every active product.
+func getIndex() ([]*entry, error) {
+	products, err := product.GetActiveProducts()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*entry{}
+	for _, p := range products {
+		entries = append(entries, toEntry(p))
+	}
+	return entries, nil
+}
+
+// toEntry parses the compatibility of p from its specifications.
+func toEntry(p *product.ActiveProduct) *entry {
+	e := &entry{
+		GUID:     p.GUID,
+		Handle:   p.Handle,
+		SKU:      p.SKU,
+		Title:    p.Title,
+		Price:    p.Price,
+		ImageURL: p.ImageURL,
+		Bands:    []string{},
+		Carriers: []string{},
+		UseCases: []string{},
+	}
+	for _, s := range p.Specifications {
+		switch {
+		case strings.EqualFold(s.Label, BandsSpecification):
+			for _, band := range parseBands(s.Value) {
+				e.Bands = appendUnique(e.Bands, band)
+			}
+		case strings.EqualFold(s.Label, CarriersSpecification):
+			for _, name := range splitList(s.Value) {
+				e.Carriers = appendUnique(e.Carriers, name)
+			}
+		case strings.EqualFold(s.Label, UseCaseSpecification):
+			for _, name := range splitList(s.Value) {
+				if u := findUseCase(name); u != nil {
+					e.UseCases = appendUnique(e.UseCases, u.Name)
+				}
+			}
+		}
+	}
+	e.Bands = sortBands(e.Bands)
+
+	return e
+}
+
+// parseBands reads the band numbers out of a specification value such as "Band 2, 4, 5, 12/17" or
+// "700 MHz Band 13". Only numbers in a list with a band prefix are read, so frequencies and generations
+// such as "5G" are skipped.
+func parseBands(value string) []string {
+	bands := []string{}
+	for _, list := range bandListPattern.FindAllStringIndex(value, -1) {
+		for _, n := range digitsPattern.FindAllStringIndex(value[list[0]:list[1]], -1) {
+			start, end := list[0]+n[0], list[0]+n[1]
+			if notBandSuffix.MatchString(value[end:]) {
+				continue
+			}
+			if band := strings.TrimLeft(value[start:end], "0"); band != "" {
+				bands = appendUnique(bands, band)
+			}
+		}
+	}
+	return bands
+}
+
+// normalizeBand turns a requested band such as "12", "B12" or "Band 12" into its number, or "" when it is not one.
+func normalizeBand(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, prefix := range bandPrefixTrims {
+		if strings.HasPrefix(s, prefix) {
+			s = strings.TrimSpace(strings.TrimPrefix(s, prefix))
+			break
+		}
+	}
+	if s == "" {
+		return ""
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return ""
+		}
+	}
+	if s = strings.TrimLeft(s, "0"); s == "" {
+		return ""
+	}
+	return s
+}
+
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range listSeparators.Split(value, -1) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func sortBands(bands []string) []string {
+	sort.SliceStable(bands, func(i, j int) bool {
+		if len(bands[i]) != len(bands[j]) {
+			return len(bands[i]) < len(bands[j])
+		}
+		return bands[i] < bands[j]
+	})
+	return bands
+}
+
+func findCarrier(carriers []*Carrier, name string) *Carrier {
+	for _, c := range carriers {
+		if strings.EqualFold(c.Name, strings.TrimSpace(name)) {
+			return c
+		}
+	}
+	return nil
+}
+
+func findUseCase(name string) *UseCase {
+	name = strings.TrimSpace(name)
+	for _, u := range UseCases {
+		if strings.EqualFold(u.Name, name) || strings.EqualFold(u.Label, name) {
+			return u
+		}
+	}
+	return nil
+}
+
+func appendUnique(values []string, value string) []string {
+	if strslice.ContainsFold(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+func getCarriersFromDbAndCache() ([]*Carrier, error) {
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("set nocount on; exec [spcCarrierBandsGet]")
+	if err != nil {
+		return nil, fmt.Errorf("spcCarrierBandsGet Query failed: %s", err)
+	}
+	defer rows.Close()
+
+	// Rows come one per band, ordered by carrier name.
+	carriers := []*Carrier{}
+	for rows.Next() {
+		var name, band string
+		if err = rows.Scan(&name, &band); err != nil {
+			return nil, fmt.Errorf("spcCarrierBandsGet Query Scan failed: %s", err)
+		}
+		if len(carriers) == 0 || carriers[len(carriers)-1].Name != name {
+			carriers = append(carriers, &Carrier{Name: name, Bands: []string{}})
+		}
+		if band = normalizeBand(band); band != "" {
+			c := carriers[len(carriers)-1]
+			c.Bands = appendUnique(c.Bands, band)
+		}
+	}
+	for _, c := range carriers {
+		c.Bands = sortBands(c.Bands)
+	}
+
+	carriersJSON, err := json.Marshal(carriers)
+	if err != nil {
+		return nil, err
+	}
+	cache.Store(carriersCacheKey, carriersJSON)
+
+	return carriers, nil
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/compatibility"
+	"github.com/wilsonelectronics/productsapi/pricelist"
+)
+
+// GetCompatibleProducts returns the products working with the carrier and band parameters and made for the
+// useCase parameter, best match first. carrier and band may be repeated or comma separated, e.g.
+// ?carrier=Verizon,AT%26T&band=12&useCase=vehicle
+func GetCompatibleProducts(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := pricelist.ForCurrency(r.FormValue("currency"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q := &compatibility.Query{
+		Carriers: listParam(r.Form["carrier"]),
+		Bands:    listParam(r.Form["band"]),
+		UseCase:  strings.TrimSpace(r.FormValue("useCase")),
+	}
+	matches, err := compatibility.Find(q, list.Currency, requestLocale(w, r))
+	if errors.Is(err, compatibility.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, matches)
+}
+
+// GetCarriers lists the carriers with their bands, and the use cases, that products can be looked up by.
+func GetCarriers(w http.ResponseWriter, r *http.Request) {
+	carriers, err := compatibility.GetCarriers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &struct {
+		Carriers []*compatibility.Carrier `json:"carriers"`
+		UseCases []*compatibility.UseCase `json:"useCases"`
+	}{carriers, compatibility.UseCases})
+}
+
+func listParam(values []string) []string {
+	items := []string{}
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				items = append(items, s)
+			}
+		}
+	}
+	return items
+}
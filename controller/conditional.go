@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wilsonelectronics/productsapi/blog"
+	"github.com/wilsonelectronics/productsapi/cache"
+	"github.com/wilsonelectronics/productsapi/inventory"
+	"github.com/wilsonelectronics/productsapi/locale"
+	"github.com/wilsonelectronics/productsapi/money"
+	"github.com/wilsonelectronics/productsapi/product"
+)
+
+const (
+	catalogMaxAge = cache.DefaultTTL
+	blogMaxAge    = blog.CacheTTL
+	sitemapMaxAge = time.Hour
+	imageMaxAge   = 24 * time.Hour
+)
+
+// writeCacheable writes a body (JSON unless a Content-Type is already set) with a strong ETag, Last-Modified (when lastModified is not zero) and
+// Cache-Control headers, answering 304 Not Modified when the request's validators still match.
+func writeCacheable(w http.ResponseWriter, r *http.Request, body []byte, lastModified time.Time, maxAge time.Duration) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Write(body)
+}
+
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
+
+func latestModifiedTime(times ...string) time.Time {
+	latest := time.Time{}
+	for _, s := range times {
+		if t := product.ParseModifiedTime(s); t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// productLastModified returns when p or the stock of its SKUs last changed, as written in currency and loc.
+// Stock changes do not touch the product, so its modified time alone would answer 304 with stale
+// availability. Vendor offers are not timed either, so a product listing them has no Last-Modified.
+func productLastModified(p *product.Product, currency, loc string) time.Time {
+	if len(p.Vendors) > 0 || !tracksModifiedTime(currency, loc) {
+		return time.Time{}
+	}
+	lastModified := time.Time{}
+	if p.Details != nil {
+		lastModified = product.ParseModifiedTime(p.Details.ModifiedTime)
+	}
+	availabilities := []*inventory.Availability{p.Availability}
+	for _, v := range p.Variants {
+		availabilities = append(availabilities, v.Availability)
+	}
+	return latestUpdate(lastModified, availabilities...)
+}
+
+// tracksModifiedTime reports whether the modified times of products cover a response in currency and loc.
+// Translations and price lists are changed without touching the products, so only the Base prices in the
+// Default locale can be answered with a Last-Modified; the others are validated by their ETag alone.
+func tracksModifiedTime(currency, loc string) bool {
+	return (currency == "" || currency == money.Base) && (loc == "" || loc == locale.Default)
+}
+
+// latestUpdate returns the later of t and the times availabilities were last updated.
+func latestUpdate(t time.Time, availabilities ...*inventory.Availability) time.Time {
+	for _, a := range availabilities {
+		if a != nil && a.UpdatedTime != nil && a.UpdatedTime.After(t) {
+			t = *a.UpdatedTime
+		}
+	}
+	return t
+}
+
+// publishTime converts a HubSpot publish date in milliseconds since the epoch.
+func publishTime(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
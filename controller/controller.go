@@ -1,20 +1,31 @@
 package controller
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/wilsonelectronics/productsapi/auth"
 	"github.com/wilsonelectronics/productsapi/blog"
 	"github.com/wilsonelectronics/productsapi/cache"
 	"github.com/wilsonelectronics/productsapi/category"
+	"github.com/wilsonelectronics/productsapi/feed"
+	"github.com/wilsonelectronics/productsapi/inventory"
+	"github.com/wilsonelectronics/productsapi/locale"
+	"github.com/wilsonelectronics/productsapi/pricelist"
 	"github.com/wilsonelectronics/productsapi/product"
+	"github.com/wilsonelectronics/productsapi/sitemap"
 	"github.com/wilsonelectronics/productsapi/tag"
 )
 
+const jsonLDContentType = "application/ld+json"
+
 // GetProduct . . .
 func GetProduct(w http.ResponseWriter, r *http.Request) {
 	handle := strings.Split(r.URL.Path, "/")[2:][0]
@@ -23,20 +34,203 @@ func GetProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	product, err := product.GetByHandle(handle)
+	w.Header().Set("Vary", "Accept")
+	if strings.Contains(r.Header.Get("Accept"), jsonLDContentType) {
+		writeProductJSONLD(w, r, handle)
+		return
+	}
+
+	opts, err := product.OptionsFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.Locale = requestLocale(w, r)
+
+	p, err := product.GetByHandleWithOptions(handle, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	productJSON, err := opts.Marshal(p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeCacheable(w, r, productJSON, productLastModified(p, opts.Currency, opts.Locale), catalogMaxAge)
+}
+
+// GetProductJSONLD returns the product as schema.org Product structured data.
+func GetProductJSONLD(w http.ResponseWriter, r *http.Request) {
+	handle := strings.Split(r.URL.Path, "/")[2:][0]
+	if handle == "" {
+		http.Error(w, "Missing product handle parameter", http.StatusBadRequest)
+		return
+	}
+
+	writeProductJSONLD(w, r, handle)
+}
+
+func writeProductJSONLD(w http.ResponseWriter, r *http.Request, handle string) {
+	loc := requestLocale(w, r)
+	p, err := product.GetByHandleWithOptions(handle, product.JSONLDOptions(loc))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ldJSON, err := json.Marshal(p.JSONLD())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonLDContentType)
+	writeCacheable(w, r, ldJSON, productLastModified(p, "", loc), catalogMaxAge)
+}
+
+// GetRelatedProducts returns the related products of the product whose handle follows /products/ in the
+// path, grouped by relationship type.
+func GetRelatedProducts(w http.ResponseWriter, r *http.Request) {
+	handle := strings.Split(r.URL.Path, "/")[2:][0]
+	if handle == "" {
+		http.Error(w, "Missing product handle parameter", http.StatusBadRequest)
+		return
+	}
+
+	list, err := pricelist.ForCurrency(r.FormValue("currency"))
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	related, err := product.GetRelated(handle, &product.Options{Currency: list.Currency, Locale: requestLocale(w, r)})
+	if errors.Is(err, product.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	productJSON, err := json.Marshal(product)
+	relatedJSON, err := json.Marshal(related)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeCacheable(w, r, relatedJSON, time.Time{}, catalogMaxAge)
+}
+
+// GetRelationshipTypes lists the relationship types related products can have.
+func GetRelationshipTypes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, product.RelationshipTypes)
+}
+
+// GetProductComparison . . .
+func GetProductComparison(w http.ResponseWriter, r *http.Request) {
+	handles := []string{}
+	for _, h := range strings.Split(r.FormValue("handles"), ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			handles = append(handles, h)
+		}
+	}
+	if len(handles) < product.MinCompareProducts || len(handles) > product.MaxCompareProducts {
+		http.Error(w, fmt.Sprintf("Provide %d to %d product handles to compare", product.MinCompareProducts, product.MaxCompareProducts), http.StatusBadRequest)
+		return
+	}
+
+	list, err := pricelist.ForCurrency(r.FormValue("currency"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comparison, err := product.Compare(handles, &product.Options{Currency: list.Currency, Locale: requestLocale(w, r)})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	comparisonJSON, err := json.Marshal(comparison)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(productJSON)
+	w.Write(comparisonJSON)
+}
+
+// GetMerchantFeed writes the Google Merchant Center feed as XML, or as TSV with format=tsv. With
+// warnings=true it instead lists the products with missing or invalid attributes.
+func GetMerchantFeed(w http.ResponseWriter, r *http.Request) {
+	f, err := feed.Get()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if showWarnings, _ := strconv.ParseBool(r.FormValue("warnings")); showWarnings {
+		warningsJSON, err := json.Marshal(f.Warnings)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(warningsJSON)
+		return
+	}
+
+	var buf bytes.Buffer
+	contentType := "application/xml; charset=utf-8"
+	if r.FormValue("format") == "tsv" {
+		contentType = "text/tab-separated-values; charset=utf-8"
+		err = feed.WriteTSV(&buf, f)
+	} else {
+		err = feed.WriteXML(&buf, f)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Feed-Warnings", strconv.Itoa(len(f.Warnings)))
+	w.Header().Set("Content-Type", contentType)
+	w.Write(buf.Bytes())
+}
+
+// GetSitemap serves /sitemap.xml, which is a sitemap index once there are more than sitemap.MaxURLs URLs,
+// and the numbered /sitemap-N.xml files the index points to.
+func GetSitemap(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	name := path.Base(r.URL.Path)
+	if name == "sitemap.xml" {
+		if err := sitemap.WriteIndexOrSitemap(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		page, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "sitemap-"), ".xml"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		ok, err := sitemap.WritePage(&buf, page)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	writeCacheable(w, r, buf.Bytes(), time.Time{}, sitemapMaxAge)
 }
 
 // GetTags . . .
@@ -55,9 +249,7 @@ func GetTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(tagsJSON)
+	writeCacheable(w, r, tagsJSON, time.Time{}, catalogMaxAge)
 }
 
 // GetTagProducts . . .
@@ -65,7 +257,14 @@ func GetTagProducts(w http.ResponseWriter, r *http.Request) {
 	inputParams := strings.Split(r.URL.Path, "/")[3:]
 	tagID := inputParams[0]
 
-	products, err := tag.GetProductsByID(tagID)
+	list, err := pricelist.ForCurrency(r.FormValue("currency"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	loc := requestLocale(w, r)
+	products, err := tag.GetLocalizedProductsByID(tagID, list.Currency, loc)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintln(w, err)
@@ -79,9 +278,17 @@ func GetTagProducts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(productsJSON)
+	modifiedTimes := []string{}
+	availabilities := []*inventory.Availability{}
+	for _, p := range products {
+		modifiedTimes = append(modifiedTimes, p.ModifiedTime)
+		availabilities = append(availabilities, p.Availability)
+	}
+	lastModified := time.Time{}
+	if tracksModifiedTime(list.Currency, loc) {
+		lastModified = latestUpdate(latestModifiedTime(modifiedTimes...), availabilities...)
+	}
+	writeCacheable(w, r, productsJSON, lastModified, catalogMaxAge)
 }
 
 // GetCategories . . .
@@ -100,33 +307,69 @@ func GetCategories(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(categoriesJSON)
+	writeCacheable(w, r, categoriesJSON, time.Time{}, catalogMaxAge)
 }
 
-// GetCategoryProducts . . .
+// GetCategoryProducts lists the products of a category matching the facet selections in the query. With
+// facets=true the list is returned as {products, facets} along with the facet counts.
 func GetCategoryProducts(w http.ResponseWriter, r *http.Request) {
 	inputParams := strings.Split(r.URL.Path, "/")[3:]
 	categoryID := inputParams[0]
 
-	products, err := category.GetProducts(categoryID)
+	list, err := pricelist.ForCurrency(r.FormValue("currency"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	loc := requestLocale(w, r)
+	products, err := category.GetProductsWithFacets(categoryID, category.SelectionsFromQuery(r.URL.Query()), list.Currency, loc)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintln(w, err)
 		return
 	}
 
-	productsJSON, err := json.Marshal(products)
+	var body interface{} = products.Products
+	if withFacets, _ := strconv.ParseBool(r.FormValue("facets")); withFacets {
+		body = products
+	}
+	productsJSON, err := json.Marshal(body)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintln(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(productsJSON)
+	// Removing a product changes none of the listed products, so the membership time counts too.
+	membershipModifiedTime, err := category.MembershipModifiedTime(categoryID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	modifiedTimes := []string{membershipModifiedTime}
+	availabilities := []*inventory.Availability{}
+	for _, p := range products.Products {
+		modifiedTimes = append(modifiedTimes, p.ModifiedTime)
+		availabilities = append(availabilities, p.Availability)
+		for _, v := range p.Variants {
+			availabilities = append(availabilities, v.Availability)
+		}
+	}
+	lastModified := time.Time{}
+	if tracksModifiedTime(list.Currency, loc) {
+		lastModified = latestUpdate(latestModifiedTime(modifiedTimes...), availabilities...)
+	}
+	writeCacheable(w, r, productsJSON, lastModified, catalogMaxAge)
+}
+
+// requestLocale negotiates the locale of the response from the locale parameter and Accept-Language header,
+// and labels the response with it.
+func requestLocale(w http.ResponseWriter, r *http.Request) string {
+	loc := locale.Negotiate(r.FormValue("locale"), r.Header.Get("Accept-Language"))
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", loc)
+	return loc
 }
 
 // GetAccessToken . . .
@@ -173,8 +416,13 @@ func GetBlogPostsAndTopics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(res)
+	lastModified := time.Time{}
+	for _, p := range response.Posts.Objects {
+		if t := publishTime(int64(p.PublishDate)); t.After(lastModified) {
+			lastModified = t
+		}
+	}
+	writeCacheable(w, r, res, lastModified, blogMaxAge)
 }
 
 // GetTopicPosts . . .
@@ -185,11 +433,17 @@ func GetTopicPosts(w http.ResponseWriter, r *http.Request) {
 	topicPosts, err := blog.GetPostsWithTopicID(topic)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	tp, _ := json.Marshal(topicPosts)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(tp)
+	lastModified := time.Time{}
+	for _, p := range topicPosts.Posts {
+		if t := publishTime(p.PublishDate); t.After(lastModified) {
+			lastModified = t
+		}
+	}
+	writeCacheable(w, r, tp, lastModified, blogMaxAge)
 }
 
 // GetPost . . .
@@ -203,9 +457,11 @@ func GetPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	p, _ := json.Marshal(postData)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(p)
-
+	lastModified := time.Time{}
+	if postData.Post != nil {
+		lastModified = publishTime(int64(postData.Post.PublishDate))
+	}
+	writeCacheable(w, r, p, lastModified, blogMaxAge)
 }
 
 // GetMorePosts . . .
@@ -228,8 +484,7 @@ func GetMorePosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(p)
+	writeCacheable(w, r, p, time.Time{}, blogMaxAge)
 }
 
 // GetRecentCaseStudies . . .
@@ -247,8 +502,7 @@ func GetRecentCaseStudies(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(postsJSON)
+	writeCacheable(w, r, postsJSON, time.Time{}, blogMaxAge)
 }
 
 // HubSpotCookie . . .
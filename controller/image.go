@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wilsonelectronics/productsapi/rendition"
+)
+
+// GetImage serves the rendition of the src image at the w width in the fm format, generating it when it is
+// not cached. Only the signed URLs the API gives out in imageSet fields are served.
+func GetImage(w http.ResponseWriter, r *http.Request) {
+	source, format := r.FormValue("src"), r.FormValue("fm")
+	width, err := strconv.Atoi(r.FormValue("w"))
+	if source == "" || err != nil {
+		http.Error(w, "src and w parameters are required", http.StatusBadRequest)
+		return
+	}
+	if !rendition.Verify(source, width, format, r.FormValue("s")) {
+		http.Error(w, "Invalid image signature", http.StatusForbidden)
+		return
+	}
+
+	img, err := rendition.Render(source, width, format)
+	if errors.Is(err, rendition.ErrInvalidRendition) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if errors.Is(err, rendition.ErrSourceUnavailable) {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", img.ContentType)
+	writeCacheable(w, r, img.Bytes, time.Time{}, imageMaxAge)
+}
+
+// GetImageSizes lists the widths image renditions are made in.
+func GetImageSizes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, rendition.Sizes)
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wilsonelectronics/productsapi/inventory"
+)
+
+const maxInventoryUpdateBytes = 8 << 20
+
+// GetAvailability returns the availability by warehouse of the SKUs in the comma separated skus parameter.
+// SKUs whose stock is not tracked are left out.
+func GetAvailability(w http.ResponseWriter, r *http.Request) {
+	skus := listParam(r.URL.Query()["skus"])
+	if len(skus) == 0 {
+		http.Error(w, "Missing skus parameter", http.StatusBadRequest)
+		return
+	}
+
+	inv, err := inventory.Get(skus...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	availability := map[string]*inventory.Availability{}
+	for _, sku := range skus {
+		if a := inv.Availability(sku); a != nil {
+			availability[sku] = a
+		}
+	}
+	writeJSON(w, http.StatusOK, availability)
+}
+
+// UpdateInventory applies the stock levels the ERP sends in the request body, a JSON array of updates.
+func UpdateInventory(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodPut) {
+		return
+	}
+
+	updates := []*inventory.Update{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxInventoryUpdateBytes)).Decode(&updates); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var validationErr *inventory.ValidationError
+	if err := inventory.Set(updates); errors.As(err, &validationErr) {
+		writeJSON(w, http.StatusUnprocessableEntity, validationErr)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAvailabilityStatuses . . .
+func GetAvailabilityStatuses(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, inventory.Statuses)
+}
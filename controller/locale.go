@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/locale"
+)
+
+// SetProductTranslation replaces the translation of a product, at /products/{handle}/translations/{locale},
+// with the texts in the request body. Notes are keyed by their noteOrder.
+func SetProductTranslation(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodPut) {
+		return
+	}
+
+	handle := strings.Split(r.URL.Path, "/")[2:][0]
+	req := &struct {
+		locale.Texts
+		Notes map[int]*locale.NoteText `json:"notes"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeTranslationResult(w, locale.SetProductTexts(path.Base(r.URL.Path), handle, &req.Texts, req.Notes))
+}
+
+// SetSpecificationTranslation sets the label of a specification, at
+// /specifications/{id}/translations/{locale}, to the label in the request body.
+func SetSpecificationTranslation(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodPut) {
+		return
+	}
+
+	id, err := strconv.Atoi(strings.Split(r.URL.Path, "/")[2:][0])
+	if err != nil {
+		http.Error(w, "invalid specification id", http.StatusBadRequest)
+		return
+	}
+	req := &struct {
+		Label string `json:"label"`
+	}{}
+	if err = json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Label) == "" {
+		http.Error(w, "label is required", http.StatusBadRequest)
+		return
+	}
+
+	writeTranslationResult(w, locale.SetSpecificationLabel(path.Base(r.URL.Path), id, req.Label))
+}
+
+func writeTranslationResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, locale.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, locale.ErrNotTranslatable):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
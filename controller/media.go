@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/product"
+)
+
+// GetProductDocuments lists the downloadable documents of the product whose handle follows /products/ in the
+// path. The language parameter keeps only documents in that language, along with those of unknown language.
+func GetProductDocuments(w http.ResponseWriter, r *http.Request) {
+	handle := strings.Split(r.URL.Path, "/")[2:][0]
+	if handle == "" {
+		http.Error(w, "Missing product handle parameter", http.StatusBadRequest)
+		return
+	}
+
+	documents, err := product.GetDocuments(handle, strings.ToLower(r.FormValue("language")))
+	if errors.Is(err, product.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, documents)
+}
+
+// GetMediaTypes . . .
+func GetMediaTypes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, product.MediaTypes)
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wilsonelectronics/productsapi/money"
+	"github.com/wilsonelectronics/productsapi/pricelist"
+	"github.com/wilsonelectronics/productsapi/product"
+)
+
+// GetProductPriceHistory returns the price changes and pending scheduled prices of the product whose handle
+// follows /products/ in the path.
+func GetProductPriceHistory(w http.ResponseWriter, r *http.Request) {
+	handle := strings.Split(r.URL.Path, "/")[2:][0]
+	if handle == "" {
+		http.Error(w, "Missing product handle parameter", http.StatusBadRequest)
+		return
+	}
+
+	history, err := product.GetPriceHistory(handle)
+	if errors.Is(err, product.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+// ScheduleProductPrice schedules the price in the request body to take effect at its effectiveTime, an
+// RFC 3339 timestamp.
+func ScheduleProductPrice(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodPost) {
+		return
+	}
+
+	handle := strings.Split(r.URL.Path, "/")[2:][0]
+	req := &struct {
+		money.Price
+		EffectiveTime time.Time `json:"effectiveTime"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !req.Price.IsSet() {
+		http.Error(w, "price is required", http.StatusBadRequest)
+		return
+	}
+
+	scheduled, err := product.SchedulePrice(handle, req.Price.Money(), req.EffectiveTime)
+	if err != nil {
+		writeProductWriteError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, scheduled)
+}
+
+// CancelScheduledProductPrice removes the scheduled price whose ID ends the path.
+func CancelScheduledProductPrice(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodDelete) {
+		return
+	}
+
+	id, err := strconv.ParseInt(path.Base(r.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid scheduled price id", http.StatusBadRequest)
+		return
+	}
+
+	if err = product.CancelScheduledPrice(id); errors.Is(err, product.ErrScheduledPriceNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetProductListPrice lists the product whose handle follows /products/ in the path at the price in the
+// request body, in that price's currency.
+func SetProductListPrice(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodPut) {
+		return
+	}
+
+	handle := strings.Split(r.URL.Path, "/")[2:][0]
+	req := &money.Price{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !req.IsSet() {
+		http.Error(w, "price is required", http.StatusBadRequest)
+		return
+	}
+
+	writePriceListResult(w, pricelist.SetPrice(handle, req.Money()))
+}
+
+// RemoveProductListPrice drops the product whose handle follows /products/ in the path from the price list
+// in the currency parameter.
+func RemoveProductListPrice(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodDelete) {
+		return
+	}
+
+	handle := strings.Split(r.URL.Path, "/")[2:][0]
+	list, err := pricelist.ForCurrency(r.FormValue("currency"))
+	if err != nil || list.Currency == money.Base {
+		http.Error(w, "currency must name a price list other than "+money.Base, http.StatusBadRequest)
+		return
+	}
+
+	writePriceListResult(w, pricelist.RemovePrice(handle, list.Currency))
+}
+
+func writePriceListResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, pricelist.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, pricelist.ErrInvalidPrice):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wilsonelectronics/productsapi/pricelist"
+	"github.com/wilsonelectronics/productsapi/selector"
+)
+
+// GetSelection runs the product selector with the answers given as query parameters named by question ID,
+// e.g. ?installation=home&squareFootage=3000, and returns the next question with the products recommended so far.
+func GetSelection(w http.ResponseWriter, r *http.Request) {
+	list, err := pricelist.ForCurrency(r.FormValue("currency"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, err := selector.GetTree()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	answers := map[string]string{}
+	query := r.URL.Query()
+	for _, q := range t.Questions {
+		if value := query.Get(q.ID); value != "" {
+			answers[q.ID] = value
+		}
+	}
+
+	result, err := selector.Select(t, answers, list.Currency, requestLocale(w, r))
+	if errors.Is(err, selector.ErrInvalidAnswer) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// GetSelectorTree . . .
+func GetSelectorTree(w http.ResponseWriter, r *http.Request) {
+	t, err := selector.GetTree()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, t)
+}
+
+// SaveSelectorTree replaces the selector's decision tree with the one in the request body.
+func SaveSelectorTree(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodPut) {
+		return
+	}
+
+	t := &selector.Tree{}
+	if err := json.NewDecoder(r.Body).Decode(t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var validationErr *selector.ValidationError
+	if err := selector.SaveTree(t); errors.As(err, &validationErr) {
+		writeJSON(w, http.StatusUnprocessableEntity, validationErr)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, t)
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/wilsonelectronics/productsapi/product"
+	"github.com/wilsonelectronics/productsapi/spec"
+)
+
+// GetSpecificationSchema returns the specification definitions of the productTypeId parameter's product type,
+// or of every product type when it is left out.
+func GetSpecificationSchema(w http.ResponseWriter, r *http.Request) {
+	productTypeID, ok := productTypeParam(w, r)
+	if !ok {
+		return
+	}
+
+	schema, err := spec.GetSchema()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &spec.Schema{Definitions: schema.ForProductType(productTypeID)})
+}
+
+// GetSpecificationTemplates returns the specification templates, grouped and ordered, of the productTypeId
+// parameter's product type or of every product type.
+func GetSpecificationTemplates(w http.ResponseWriter, r *http.Request) {
+	productTypeID, ok := productTypeParam(w, r)
+	if !ok {
+		return
+	}
+
+	schema, err := spec.GetSchema()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, schema.Templates(productTypeID))
+}
+
+// GetSpecificationReport lists the products, of the productTypeId parameter's product type or of every
+// product type, with missing, extra or invalid specifications.
+func GetSpecificationReport(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodGet) {
+		return
+	}
+
+	productTypeID, ok := productTypeParam(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := product.GetSpecificationReport(productTypeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// productTypeParam reads the optional productTypeId parameter, answering the request when it is not valid.
+func productTypeParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	s := r.FormValue("productTypeId")
+	if s == "" {
+		return 0, true
+	}
+	id, err := strconv.Atoi(s)
+	if err != nil || id <= 0 {
+		http.Error(w, "productTypeId must be a positive number", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wilsonelectronics/productsapi/product"
+)
+
+const (
+	clicksDateLayout     = "2006-01-02"
+	defaultClicksPeriod  = 30 * 24 * time.Hour
+	maxVendorOffersBytes = 8 << 20
+)
+
+// ClickThroughVendor records a click from the product whose handle follows /products/ in the path to the
+// vendorId parameter's vendor, and redirects to the vendor's tracking link.
+func ClickThroughVendor(w http.ResponseWriter, r *http.Request) {
+	handle := strings.Split(r.URL.Path, "/")[2:][0]
+	if handle == "" {
+		http.Error(w, "Missing product handle parameter", http.StatusBadRequest)
+		return
+	}
+	vendorID, err := strconv.Atoi(r.FormValue("vendorId"))
+	if err != nil || vendorID <= 0 {
+		http.Error(w, "vendorId must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	target, err := product.RecordVendorClick(handle, vendorID, r.Referer())
+	if err != nil {
+		writeProductWriteError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// GetVendorClicks counts the click-throughs per product and vendor between the from and to dates
+// (2006-01-02, to inclusive), the last 30 days by default.
+func GetVendorClicks(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodGet) {
+		return
+	}
+
+	to := time.Now()
+	if s := r.FormValue("to"); s != "" {
+		day, err := time.Parse(clicksDateLayout, s)
+		if err != nil {
+			http.Error(w, "to must be a date such as 2006-01-02", http.StatusBadRequest)
+			return
+		}
+		to = day.AddDate(0, 0, 1)
+	}
+	from := to.Add(-defaultClicksPeriod)
+	if s := r.FormValue("from"); s != "" {
+		day, err := time.Parse(clicksDateLayout, s)
+		if err != nil {
+			http.Error(w, "from must be a date such as 2006-01-02", http.StatusBadRequest)
+			return
+		}
+		from = day
+	}
+
+	clicks, err := product.GetVendorClicks(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, clicks)
+}
+
+// GetVendors lists the vendors with their URL templates.
+func GetVendors(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodGet) {
+		return
+	}
+
+	vendors, err := product.GetVendors()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, vendors)
+}
+
+// SetVendorURLTemplate sets the urlTemplate in the request body on the vendor whose ID ends the path.
+func SetVendorURLTemplate(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodPut) {
+		return
+	}
+
+	vendorID, err := strconv.Atoi(path.Base(r.URL.Path))
+	if err != nil {
+		http.Error(w, "invalid vendor id", http.StatusBadRequest)
+		return
+	}
+	req := &struct {
+		URLTemplate string `json:"urlTemplate"`
+	}{}
+	if err = json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = product.SetVendorURLTemplate(vendorID, req.URLTemplate); err != nil {
+		writeProductWriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateVendorOffers records the vendor prices and stock statuses in the request body, a JSON array of offers.
+func UpdateVendorOffers(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodPut) {
+		return
+	}
+
+	offers := []*product.VendorOffer{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxVendorOffersBytes)).Decode(&offers); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := product.SetVendorOffers(offers); err != nil {
+		writeProductWriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetStockStatuses lists the stock statuses vendors can report.
+func GetStockStatuses(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, product.StockStatuses)
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/wilsonelectronics/productsapi/category"
+	"github.com/wilsonelectronics/productsapi/webhook"
+)
+
+const defaultDeliveryLimit = 100
+
+// CreateWebhookSubscription registers a URL for the event types in the request body. The response carries the
+// signing secret, which is not returned again.
+func CreateWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodPost) {
+		return
+	}
+
+	req := &struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"eventTypes"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s, err := webhook.Subscribe(req.URL, req.EventTypes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, s)
+}
+
+// GetWebhookSubscriptions . . .
+func GetWebhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodGet) {
+		return
+	}
+
+	subscriptions, err := webhook.GetSubscriptions(false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, subscriptions)
+}
+
+// DeleteWebhookSubscription . . .
+func DeleteWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodDelete) {
+		return
+	}
+
+	id, err := strconv.ParseInt(path.Base(r.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid subscription id", http.StatusBadRequest)
+		return
+	}
+
+	if err = webhook.Unsubscribe(id); errors.Is(err, webhook.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries returns the delivery log of the subscriptionId parameter, newest first. status=dead
+// lists the dead letters.
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodGet) {
+		return
+	}
+
+	subscriptionID, err := strconv.ParseInt(r.FormValue("subscriptionId"), 10, 64)
+	if err != nil {
+		http.Error(w, "subscriptionId is required", http.StatusBadRequest)
+		return
+	}
+	limit := defaultDeliveryLimit
+	if r.FormValue("limit") != "" {
+		if limit, err = strconv.Atoi(r.FormValue("limit")); err != nil || limit < 1 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	deliveries, err := webhook.GetDeliveries(subscriptionID, r.FormValue("status"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// RedeliverWebhook queues the delivery whose ID ends the path to be sent again.
+func RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodPost) {
+		return
+	}
+
+	id, err := strconv.ParseInt(path.Base(r.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid delivery id", http.StatusBadRequest)
+		return
+	}
+
+	if err = webhook.Redeliver(id); errors.Is(err, webhook.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// AddCategoryProduct adds the product with the handle parameter to the category whose GUID ends the path.
+func AddCategoryProduct(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodPost) {
+		return
+	}
+	writeMembershipResult(w, category.AddProduct(path.Base(r.URL.Path), r.FormValue("handle")))
+}
+
+// RemoveCategoryProduct . . .
+func RemoveCategoryProduct(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodDelete) {
+		return
+	}
+	writeMembershipResult(w, category.RemoveProduct(path.Base(r.URL.Path), r.FormValue("handle")))
+}
+
+func writeMembershipResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, category.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
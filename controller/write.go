@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/auth"
+	"github.com/wilsonelectronics/productsapi/changefeed"
+	"github.com/wilsonelectronics/productsapi/product"
+)
+
+const maxImportBytes = 32 << 20
+
+// CreateProduct . . .
+func CreateProduct(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodPost) {
+		return
+	}
+
+	p := &product.Product{}
+	if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := product.Create(p)
+	if err != nil {
+		writeProductWriteError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// UpdateProduct . . .
+func UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodPut) {
+		return
+	}
+
+	handle := path.Base(r.URL.Path)
+	p := &product.Product{}
+	if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if p.Details == nil || p.Details.ModifiedTime == "" {
+		http.Error(w, "details.modifiedTime is required to update a product", http.StatusPreconditionRequired)
+		return
+	}
+
+	updated, err := product.Update(handle, p)
+	if err != nil {
+		writeProductWriteError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeleteProduct . . .
+func DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodDelete) {
+		return
+	}
+
+	modifiedTime := r.FormValue("modifiedTime")
+	if modifiedTime == "" {
+		http.Error(w, "modifiedTime is required to delete a product", http.StatusPreconditionRequired)
+		return
+	}
+
+	if err := product.Delete(path.Base(r.URL.Path), modifiedTime); err != nil {
+		writeProductWriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ImportProducts accepts a CSV (text/csv) or JSON array of products and returns the import report. Nothing is
+// written when dryRun=true is given or when any row is invalid.
+func ImportProducts(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodPost) {
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	var rows []*product.ImportRow
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		rows, err = product.ReadImportCSV(body)
+	} else {
+		rows, err = product.ReadImportJSON(body)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := product.Import(rows, dryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if report.Invalid > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, report)
+}
+
+// ExportProducts streams the whole catalog as csv, jsonl or spreadsheet (the format parameter, csv by
+// default), limited to the comma separated columns parameter when given.
+func ExportProducts(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodGet) {
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = product.ExportCSV
+	}
+	columns := []string{}
+	for _, c := range strings.Split(r.FormValue("columns"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			columns = append(columns, c)
+		}
+	}
+
+	out := &lazyHeaderWriter{ResponseWriter: w, header: func() {
+		w.Header().Set("Content-Type", product.ExportContentType(format))
+		w.Header().Set("Content-Disposition", `attachment; filename="`+product.ExportFileName(format)+`"`)
+	}}
+	err := product.Export(out, format, columns)
+	if err == nil || out.wrote {
+		return
+	}
+	if errors.Is(err, product.ErrInvalidExport) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	} else {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// lazyHeaderWriter sets the response headers on the first write, so a request that fails before any output
+// can still be answered with an error.
+type lazyHeaderWriter struct {
+	http.ResponseWriter
+	header func()
+	wrote  bool
+}
+
+func (w *lazyHeaderWriter) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.header()
+		w.wrote = true
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// GetProductChanges returns the product change events after the cursor parameter, up to limit of them.
+// Consumers pass back the nextCursor of each response to resume where they left off.
+func GetProductChanges(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, http.MethodGet) {
+		return
+	}
+
+	cursor, err := strconv.ParseInt(r.FormValue("cursor"), 10, 64)
+	if r.FormValue("cursor") != "" && (err != nil || cursor < 0) {
+		http.Error(w, "cursor must be a non-negative number", http.StatusBadRequest)
+		return
+	}
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if r.FormValue("limit") != "" && (err != nil || limit < 1) {
+		http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	page, err := changefeed.Since(cursor, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// authorize checks the method and credentials of a request to a protected endpoint, reads and writes alike,
+// answering it when they are not acceptable.
+func authorize(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if !auth.IsAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func writeProductWriteError(w http.ResponseWriter, err error) {
+	var validationErr *product.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		writeJSON(w, http.StatusUnprocessableEntity, validationErr)
+	case errors.Is(err, product.ErrNotFound), errors.Is(err, product.ErrVendorNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, product.ErrConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
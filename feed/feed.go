@@ -0,0 +1,271 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/wilsonelectronics/productsapi/cache"
+	"github.com/wilsonelectronics/productsapi/inventory"
+	"github.com/wilsonelectronics/productsapi/product"
+)
+
+const (
+	cacheKey          = cache.MerchantFeedKey
+	cacheTTL          = time.Hour
+	maxTitle          = 150
+	maxDescription    = 5000
+	maxAdditionalImgs = 10
+)
+
+var tagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// Feed is the Merchant Center feed along with the problems found while building it.
+type Feed struct {
+	Items    []*Item    `json:"items"`
+	Warnings []*Warning `json:"warnings"`
+}
+
+// Item is one product in Merchant Center's attribute names.
+type Item struct {
+	ID                   string   `json:"id"`
+	Title                string   `json:"title"`
+	Description          string   `json:"description"`
+	Link                 string   `json:"link"`
+	ImageLink            string   `json:"image_link"`
+	AdditionalImageLinks []string `json:"additional_image_link,omitempty"`
+	Availability         string   `json:"availability"`
+	Price                string   `json:"price"`
+	Brand                string   `json:"brand"`
+	GTIN                 string   `json:"gtin,omitempty"`
+	MPN                  string   `json:"mpn"`
+	Condition            string   `json:"condition"`
+	IdentifierExists     string   `json:"identifier_exists,omitempty"`
+	ProductType          string   `json:"product_type,omitempty"`
+}
+
+// Warning . . .
+type Warning struct {
+	// Handle is empty for problems with the whole feed.
+	Handle  string `json:"handle"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	// Excluded is set when the problem keeps the product out of the feed.
+	Excluded bool `json:"excluded"`
+}
+
+// Get returns the feed, building it from the catalog when it is not cached.
+func Get() (*Feed, error) {
+	bytes, err := cache.Retrieve(cacheKey)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Feed{}
+	if bytes != nil {
+		err = json.Unmarshal(bytes, f)
+		return f, err
+	}
+
+	if f, err = build(); err != nil {
+		return nil, err
+	}
+
+	feedJSON, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	cache.StoreFor(cacheKey, feedJSON, cacheTTL)
+
+	return f, nil
+}
+
+// feedAvailability maps inventory statuses to Merchant Center availability values. Merchant Center needs a
+// restock date for backorder, which the inventory does not have, so backordered products are out of stock.
+var feedAvailability = map[string]string{
+	inventory.StatusInStock:      "in_stock",
+	inventory.StatusLowStock:     "in_stock",
+	inventory.StatusBackorder:    "out_of_stock",
+	inventory.StatusDiscontinued: "out_of_stock",
+}
+
+// build maps every product to a feed item. Walked products come with their availability.
+func build() (*Feed, error) {
+	f := &Feed{Items: []*Item{}, Warnings: []*Warning{}}
+	// The site URL is the same for every product, so it is warned about once for the whole feed.
+	if os.Getenv("SITE_URL") == "" {
+		f.Warnings = append(f.Warnings, &Warning{Field: "link", Message: "SITE_URL is not set so links are relative"})
+	}
+	err := product.Walk(func(p *product.Product) error {
+		// Products that cannot be bought on the site are left out rather than listed as out of stock.
+		if !p.Details.IsActive || p.Details.IsDeleted {
+			return nil
+		}
+		item, warnings := toItem(p, p.Availability)
+		f.Warnings = append(f.Warnings, warnings...)
+		if item != nil {
+			f.Items = append(f.Items, item)
+		}
+		return nil
+	})
+	return f, err
+}
+
+// toItem maps a product and its availability, nil when its stock is not tracked, to a feed item, returning a
+// nil item when a required attribute is missing.
+func toItem(p *product.Product, availability *inventory.Availability) (*Item, []*Warning) {
+	d := p.Details
+	warnings := []*Warning{}
+	warn := func(field, message string, excluded bool) {
+		warnings = append(warnings, &Warning{Handle: d.Handle, Field: field, Message: message, Excluded: excluded})
+	}
+
+	item := &Item{
+		ID:           p.GUID,
+		Title:        truncate(d.Title, maxTitle),
+		Description:  truncate(plainText(d.Description.StringOr(d.DescriptionShort.StringOr(""))), maxDescription),
+		Link:         product.PageURL(d.Handle),
+		ImageLink:    d.ImageURL,
+		Availability: "in_stock",
+		Price:        d.Price.Money().Format(),
+		Brand:        product.Brand,
+		MPN:          p.SKU,
+		Condition:    "new",
+		ProductType:  p.ProductType,
+	}
+	if availability != nil {
+		item.Availability = feedAvailability[availability.Status]
+	}
+
+	for _, m := range p.Medias {
+		if m.IsActive && m.MediaTypeID == product.MediaTypeImage && m.MediaLinkURL.Valid && m.MediaLinkURL.Chars != d.ImageURL &&
+			len(item.AdditionalImageLinks) < maxAdditionalImgs {
+			item.AdditionalImageLinks = append(item.AdditionalImageLinks, m.MediaLinkURL.Chars)
+		}
+	}
+
+	excluded := false
+	if strings.TrimSpace(item.Title) == "" {
+		warn("title", "missing title", true)
+		excluded = true
+	} else if utf8.RuneCountInString(d.Title) > maxTitle {
+		warn("title", fmt.Sprintf("title is longer than %d characters and was truncated", maxTitle), false)
+	}
+	if strings.TrimSpace(item.Description) == "" {
+		warn("description", "missing description", true)
+		excluded = true
+	}
+	if item.ImageLink == "" {
+		warn("image_link", "missing image", true)
+		excluded = true
+	}
+	if d.Price.Money().Units() <= 0 {
+		warn("price", "price must be greater than zero", true)
+		excluded = true
+	}
+	if product.ValidGTIN(p.UPC) {
+		item.GTIN = p.UPC
+	} else {
+		if p.UPC == "" {
+			warn("gtin", "missing UPC; identified by brand and SKU instead", false)
+		} else {
+			warn("gtin", fmt.Sprintf("UPC %s is not a valid GTIN; identified by brand and SKU instead", p.UPC), false)
+		}
+		if item.MPN == "" {
+			item.IdentifierExists = "no"
+		}
+	}
+
+	if excluded {
+		return nil, warnings
+	}
+	return item, warnings
+}
+
+// WriteXML writes the feed as an RSS 2.0 document using the Google namespace.
+func WriteXML(w io.Writer, f *Feed) error {
+	type xmlItem struct {
+		ID                   string   `xml:"g:id"`
+		Title                string   `xml:"g:title"`
+		Description          string   `xml:"g:description"`
+		Link                 string   `xml:"g:link"`
+		ImageLink            string   `xml:"g:image_link"`
+		AdditionalImageLinks []string `xml:"g:additional_image_link"`
+		Availability         string   `xml:"g:availability"`
+		Price                string   `xml:"g:price"`
+		Brand                string   `xml:"g:brand"`
+		GTIN                 string   `xml:"g:gtin,omitempty"`
+		MPN                  string   `xml:"g:mpn,omitempty"`
+		Condition            string   `xml:"g:condition"`
+		IdentifierExists     string   `xml:"g:identifier_exists,omitempty"`
+		ProductType          string   `xml:"g:product_type,omitempty"`
+	}
+	type rss struct {
+		XMLName xml.Name  `xml:"rss"`
+		Version string    `xml:"version,attr"`
+		NS      string    `xml:"xmlns:g,attr"`
+		Title   string    `xml:"channel>title"`
+		Link    string    `xml:"channel>link"`
+		Desc    string    `xml:"channel>description"`
+		Items   []xmlItem `xml:"channel>item"`
+	}
+
+	doc := rss{
+		Version: "2.0",
+		NS:      "http://base.google.com/ns/1.0",
+		Title:   product.Brand + " products",
+		Link:    os.Getenv("SITE_URL"),
+		Desc:    product.Brand + " product feed",
+		Items:   []xmlItem{},
+	}
+	for _, i := range f.Items {
+		doc.Items = append(doc.Items, xmlItem(*i))
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// WriteTSV writes the feed as a tab separated file with a header row of attribute names.
+func WriteTSV(w io.Writer, f *Feed) error {
+	columns := []string{"id", "title", "description", "link", "image_link", "additional_image_link", "availability",
+		"price", "brand", "gtin", "mpn", "condition", "identifier_exists", "product_type"}
+	if _, err := io.WriteString(w, strings.Join(columns, "\t")+"\n"); err != nil {
+		return err
+	}
+
+	for _, i := range f.Items {
+		values := []string{i.ID, i.Title, i.Description, i.Link, i.ImageLink, strings.Join(i.AdditionalImageLinks, ","),
+			i.Availability, i.Price, i.Brand, i.GTIN, i.MPN, i.Condition, i.IdentifierExists, i.ProductType}
+		for j, v := range values {
+			values[j] = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(v)
+		}
+		if _, err := io.WriteString(w, strings.Join(values, "\t")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func plainText(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(tagPattern.ReplaceAllString(s, " "))), " ")
+}
+
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max])
+}
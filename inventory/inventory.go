@@ -0,0 +1,339 @@
+package inventory
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wilsonelectronics/productsapi/cache"
+	"github.com/wilsonelectronics/productsapi/data"
+)
+
+const cacheKeyPrefix = "inventory:"
+
+// Availability statuses.
+const (
+	// StatusInStock . . .
+	StatusInStock = "inStock"
+	// StatusLowStock is in stock at or below the SKU's low stock threshold.
+	StatusLowStock = "lowStock"
+	// StatusBackorder is out of stock but still sold, to ship when restocked.
+	StatusBackorder = "backorder"
+	// StatusDiscontinued is out of stock and not restocked. Discontinued SKUs with stock left keep their
+	// stock status until they sell out.
+	StatusDiscontinued = "discontinued"
+)
+
+// Statuses . . .
+var Statuses = []string{StatusInStock, StatusLowStock, StatusBackorder, StatusDiscontinued}
+
+// DefaultLowStockThreshold is the quantity at or below which SKUs without a threshold of their own are low.
+const DefaultLowStockThreshold = 5
+
+// ValidationError lists every problem found with a stock update.
+type ValidationError struct {
+	Problems []string `json:"problems"`
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid stock update: " + strings.Join(e.Problems, "; ")
+}
+
+// Stock is the inventory of one SKU across the warehouses.
+type Stock struct {
+	SKU               string            `json:"sku"`
+	Discontinued      bool              `json:"discontinued"`
+	LowStockThreshold int               `json:"lowStockThreshold"`
+	Warehouses        []*WarehouseStock `json:"warehouses"`
+}
+
+// WarehouseStock . . .
+type WarehouseStock struct {
+	Code        string    `json:"code"`
+	Name        string    `json:"name"`
+	Quantity    int       `json:"quantity"`
+	UpdatedTime time.Time `json:"updatedTime"`
+}
+
+// Availability is what customers are shown of the stock of a SKU. Warehouses is left out of listings.
+type Availability struct {
+	Status      string                   `json:"status"`
+	Quantity    int                      `json:"quantity"`
+	Warehouses  []*WarehouseAvailability `json:"warehouses,omitempty"`
+	UpdatedTime *time.Time               `json:"updatedTime,omitempty"`
+}
+
+// WarehouseAvailability . . .
+type WarehouseAvailability struct {
+	Code      string `json:"code"`
+	Name      string `json:"name"`
+	Quantity  int    `json:"quantity"`
+	Available bool   `json:"available"`
+}
+
+// Update is a stock level pushed by the ERP. Only the warehouses listed are changed. Discontinued and
+// LowStockThreshold are kept as they are when nil.
+type Update struct {
+	SKU               string             `json:"sku"`
+	Warehouses        []*WarehouseUpdate `json:"warehouses"`
+	Discontinued      *bool              `json:"discontinued"`
+	LowStockThreshold *int               `json:"lowStockThreshold"`
+}
+
+// WarehouseUpdate . . .
+type WarehouseUpdate struct {
+	Code     string `json:"code"`
+	Quantity int    `json:"quantity"`
+}
+
+// Inventory maps SKUs to their stock.
+type Inventory map[string]*Stock
+
+// Get returns the stock of skus. Each SKU is cached on its own, so only the SKUs not cached are loaded, and
+// SKUs whose stock is not tracked are cached as such.
+func Get(skus ...string) (Inventory, error) {
+	keys := make([]string, len(skus))
+	for i, sku := range skus {
+		keys[i] = cacheKey(sku)
+	}
+	cached, err := cache.RetrieveMany(keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := Inventory{}
+	missing := []string{}
+	for i, bytes := range cached {
+		if bytes == nil {
+			missing = append(missing, skus[i])
+			continue
+		}
+		s := &Stock{}
+		if err = json.Unmarshal(bytes, &s); err != nil {
+			return nil, err
+		}
+		if s != nil {
+			inventory[skus[i]] = s
+		}
+	}
+	if len(missing) == 0 {
+		return inventory, nil
+	}
+
+	loaded, err := getFromDbAndCache(missing)
+	if err != nil {
+		return nil, err
+	}
+	for sku, s := range loaded {
+		inventory[sku] = s
+	}
+	return inventory, nil
+}
+
+// Availability returns the availability of sku by warehouse, or nil when its stock is not tracked.
+func (inv Inventory) Availability(sku string) *Availability {
+	s, ok := inv[sku]
+	if !ok {
+		return nil
+	}
+
+	a := &Availability{Warehouses: []*WarehouseAvailability{}}
+	for _, w := range s.Warehouses {
+		a.Warehouses = append(a.Warehouses, &WarehouseAvailability{
+			Code:      w.Code,
+			Name:      w.Name,
+			Quantity:  available(w.Quantity),
+			Available: w.Quantity > 0,
+		})
+		a.Quantity += available(w.Quantity)
+		if a.UpdatedTime == nil || w.UpdatedTime.After(*a.UpdatedTime) {
+			updated := w.UpdatedTime
+			a.UpdatedTime = &updated
+		}
+	}
+	a.Status = status(a.Quantity, s.LowStockThreshold, s.Discontinued)
+	return a
+}
+
+// Summary returns the availability of sku without the warehouses, for listings, or nil when its stock is
+// not tracked.
+func (inv Inventory) Summary(sku string) *Availability {
+	a := inv.Availability(sku)
+	if a != nil {
+		a.Warehouses = nil
+	}
+	return a
+}
+
+// Set applies stock updates from the ERP. Nothing is written when any update is invalid or names an
+// unknown SKU or warehouse. Only the cached stock of the updated SKUs and the merchant feed are dropped:
+// products and listings are cached without their availability, which is added to each response, while the
+// feed is cached with it.
+func Set(updates []*Update) error {
+	problems := []string{}
+	for i, u := range updates {
+		if strings.TrimSpace(u.SKU) == "" {
+			problems = append(problems, fmt.Sprintf("updates[%d].sku is required", i))
+		}
+		if u.LowStockThreshold != nil && *u.LowStockThreshold < 0 {
+			problems = append(problems, fmt.Sprintf("updates[%d].lowStockThreshold cannot be negative", i))
+		}
+		if len(u.Warehouses) == 0 && u.Discontinued == nil && u.LowStockThreshold == nil {
+			problems = append(problems, fmt.Sprintf("updates[%d] changes nothing", i))
+		}
+		for j, w := range u.Warehouses {
+			if strings.TrimSpace(w.Code) == "" {
+				problems = append(problems, fmt.Sprintf("updates[%d].warehouses[%d].code is required", i, j))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, u := range updates {
+		var discontinued, threshold interface{}
+		if u.Discontinued != nil {
+			discontinued = *u.Discontinued
+		}
+		if u.LowStockThreshold != nil {
+			threshold = *u.LowStockThreshold
+		}
+		if n, err := execCount(tx, "spcInventorySkuSet", u.SKU, discontinued, threshold); err != nil {
+			return err
+		} else if n == 0 {
+			problems = append(problems, fmt.Sprintf("updates[%d]: sku %s is not a product or variant", i, u.SKU))
+			continue
+		}
+
+		for j, w := range u.Warehouses {
+			if n, err := execCount(tx, "spcInventoryLevelSet", u.SKU, w.Code, w.Quantity); err != nil {
+				return err
+			} else if n == 0 {
+				problems = append(problems, fmt.Sprintf("updates[%d].warehouses[%d]: %s is not a warehouse", i, j, w.Code))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	keys := []string{cache.MerchantFeedKey}
+	for _, u := range updates {
+		keys = append(keys, cacheKey(u.SKU))
+	}
+	cache.Delete(keys...)
+	return nil
+}
+
+func getFromDbAndCache(skus []string) (Inventory, error) {
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("set nocount on; exec [spcInventoryGet] ?", strings.Join(skus, ","))
+	if err != nil {
+		return nil, fmt.Errorf("spcInventoryGet Query failed: %s", err)
+	}
+	defer rows.Close()
+
+	inventory := Inventory{}
+	for rows.Next() {
+		var sku string
+		var discontinued bool
+		var threshold sql.NullInt64
+		var code, name sql.NullString
+		var quantity sql.NullInt64
+		var updatedTime sql.NullTime
+		if err = rows.Scan(&sku, &discontinued, &threshold, &code, &name, &quantity, &updatedTime); err != nil {
+			return nil, fmt.Errorf("spcInventoryGet Query Scan failed: %s", err)
+		}
+
+		s, ok := inventory[sku]
+		if !ok {
+			s = &Stock{SKU: sku, Discontinued: discontinued, LowStockThreshold: DefaultLowStockThreshold, Warehouses: []*WarehouseStock{}}
+			if threshold.Valid {
+				s.LowStockThreshold = int(threshold.Int64)
+			}
+			inventory[sku] = s
+		}
+		// SKUs with no warehouse levels yet have a single row without a warehouse.
+		if code.Valid {
+			s.Warehouses = append(s.Warehouses, &WarehouseStock{
+				Code:        code.String,
+				Name:        name.String,
+				Quantity:    int(quantity.Int64),
+				UpdatedTime: updatedTime.Time,
+			})
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, sku := range skus {
+		stockJSON, err := json.Marshal(inventory[sku])
+		if err != nil {
+			return nil, err
+		}
+		cache.Store(cacheKey(sku), stockJSON)
+	}
+
+	return inventory, nil
+}
+
+func cacheKey(sku string) string {
+	return cacheKeyPrefix + sku
+}
+
+// execCount runs a stored procedure and returns how many rows it changed.
+func execCount(tx *sql.Tx, name string, args ...interface{}) (int64, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	result, err := tx.Exec(fmt.Sprintf("set nocount off; exec [%s] %s", name, placeholders), args...)
+	if err != nil {
+		return 0, fmt.Errorf("%s failed: %s", name, err)
+	}
+	return result.RowsAffected()
+}
+
+func status(quantity int, threshold int, discontinued bool) string {
+	switch {
+	case quantity <= 0 && discontinued:
+		return StatusDiscontinued
+	case quantity <= 0:
+		return StatusBackorder
+	case quantity <= threshold:
+		return StatusLowStock
+	default:
+		return StatusInStock
+	}
+}
+
+// available is what of a warehouse quantity can be sold. The ERP reports backordered units as negative stock.
+func available(quantity int) int {
+	if quantity < 0 {
+		return 0
+	}
+	return quantity
+}
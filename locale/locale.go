@@ -0,0 +1,433 @@
+package locale
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/cache"
+	"github.com/wilsonelectronics/productsapi/data"
+
+	"github.com/piotrkowalczuk/ntypes"
+)
+
+const (
+	// English . . .
+	English = "en"
+	// French . . .
+	French = "fr"
+
+	// Default is the locale content is written in, and the one used when no supported locale is asked for.
+	Default = English
+
+	cacheKeyPrefix = "translations:"
+)
+
+// Supported lists the locales content can be translated to.
+var Supported = []string{English, French}
+
+var (
+	// ErrNotFound . . .
+	ErrNotFound = errors.New("product or specification not found")
+	// ErrNotTranslatable is returned when writing a translation into Default or an unsupported locale.
+	ErrNotTranslatable = errors.New("locale cannot be translated to")
+)
+
+// Texts holds the translated text fields of a product. Fields that are null fall back to the Default text.
+type Texts struct {
+	Title            ntypes.String `json:"title"`
+	Description      ntypes.String `json:"description"`
+	DescriptionShort ntypes.String `json:"descriptionShort"`
+	BodyHTML         ntypes.String `json:"body_HTML"`
+}
+
+// NoteText holds the translated text of a note.
+type NoteText struct {
+	NoteTitle ntypes.String `json:"noteTitle"`
+	NoteText  ntypes.String `json:"noteText"`
+}
+
+// Translations holds every translation into one locale. Notes are keyed by product GUID and then note order,
+// since notes are rewritten with new GUIDs whenever their product is saved.
+type Translations struct {
+	Locale              string                       `json:"locale"`
+	Products            map[string]*Texts            `json:"products"`
+	Notes               map[string]map[int]*NoteText `json:"notes"`
+	SpecificationLabels map[int]string               `json:"specificationLabels"`
+}
+
+// Negotiate picks the supported locale to answer with: param when it names one, otherwise the most
+// preferred supported language of an Accept-Language header, otherwise Default. Regional variants such as
+// fr-CA match their language.
+func Negotiate(param string, acceptLanguage string) string {
+	if l := supported(param); l != "" {
+		return l
+	}
+
+	type preference struct {
+		tag string
+		q   float64
+	}
+	preferences := []preference{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+		p := preference{tag: strings.TrimSpace(fields[0]), q: 1}
+		for _, f := range fields[1:] {
+			if f = strings.TrimSpace(f); strings.HasPrefix(f, "q=") {
+				if q, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					p.q = q
+				}
+			}
+		}
+		if p.tag != "" && p.q > 0 {
+			preferences = append(preferences, p)
+		}
+	}
+	sort.SliceStable(preferences, func(i, j int) bool { return preferences[i].q > preferences[j].q })
+
+	for _, p := range preferences {
+		if l := supported(p.tag); l != "" {
+			return l
+		}
+	}
+	return Default
+}
+
+func supported(tag string) string {
+	language := strings.ToLower(strings.TrimSpace(strings.SplitN(strings.Replace(tag, "_", "-", -1), "-", 2)[0]))
+	for _, l := range Supported {
+		if l == language {
+			return l
+		}
+	}
+	return ""
+}
+
+// Get returns every translation into locale, for listings that show many products. Default has none, so its
+// Translations are empty.
+func Get(locale string) (*Translations, error) {
+	if locale == "" || locale == Default {
+		return &Translations{Locale: Default}, nil
+	}
+
+	bytes, err := cache.Retrieve(cacheKeyPrefix + locale)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes == nil {
+		return getFromDbAndCache(locale)
+	}
+
+	t := &Translations{}
+	err = json.Unmarshal(bytes, t)
+	return t, err
+}
+
+// GetForProduct returns the translations into locale of the product with guid and of the specification
+// labels, without loading the other products' translations. Each product is cached under a key of its own.
+func GetForProduct(locale string, guid string) (*Translations, error) {
+	if locale == "" || locale == Default {
+		return &Translations{Locale: Default}, nil
+	}
+
+	labels, err := getSpecificationLabels(locale)
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := cache.Retrieve(productCacheKey(locale, guid))
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Translations{}
+	if bytes == nil {
+		if t, err = getProductFromDbAndCache(locale, guid); err != nil {
+			return nil, err
+		}
+	} else if err = json.Unmarshal(bytes, t); err != nil {
+		return nil, err
+	}
+	t.SpecificationLabels = labels
+	return t, nil
+}
+
+// Product returns the translated texts of the product with guid, or empty Texts when it has none.
+func (t *Translations) Product(guid string) *Texts {
+	if texts, ok := t.Products[guid]; ok {
+		return texts
+	}
+	return &Texts{}
+}
+
+// Note returns the translated text of the note at order of the product with guid, or an empty NoteText.
+func (t *Translations) Note(guid string, order int) *NoteText {
+	if n, ok := t.Notes[guid][order]; ok {
+		return n
+	}
+	return &NoteText{}
+}
+
+// SpecificationLabel returns the translated label of a specification, or label when it has none.
+func (t *Translations) SpecificationLabel(id int, label string) string {
+	if translated, ok := t.SpecificationLabels[id]; ok {
+		return translated
+	}
+	return label
+}
+
+// SetProductTexts replaces the translation into locale of the product with handle and of its notes, which are
+// keyed by note order.
+func SetProductTexts(locale string, handle string, texts *Texts, notes map[int]*NoteText) error {
+	if err := checkTranslatable(locale); err != nil {
+		return err
+	}
+
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var guid string
+	err = tx.QueryRow("set nocount on; exec [spcProductTranslationSet] ?, ?, ?, ?, ?, ?",
+		locale,
+		handle,
+		texts.Title,
+		texts.Description,
+		texts.DescriptionShort,
+		texts.BodyHTML).Scan(&guid)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("spcProductTranslationSet failed: %s", err)
+	}
+
+	if _, err = tx.Exec("set nocount on; exec [spcProductNoteTranslationsDelete] ?, ?", locale, guid); err != nil {
+		return fmt.Errorf("spcProductNoteTranslationsDelete failed: %s", err)
+	}
+	for order, n := range notes {
+		if _, err = tx.Exec("set nocount on; exec [spcProductNoteTranslationInsert] ?, ?, ?, ?, ?", locale, guid, order, n.NoteTitle, n.NoteText); err != nil {
+			return fmt.Errorf("spcProductNoteTranslationInsert failed: %s", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	cache.Delete(cacheKeyPrefix+locale, productCacheKey(locale, guid))
+	return nil
+}
+
+// SetSpecificationLabel sets the label of a specification in locale.
+func SetSpecificationLabel(locale string, specificationID int, label string) error {
+	if err := checkTranslatable(locale); err != nil {
+		return err
+	}
+
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("set nocount off; exec [spcSpecificationTranslationSet] ?, ?, ?", locale, specificationID, label)
+	if err != nil {
+		return fmt.Errorf("spcSpecificationTranslationSet failed: %s", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	cache.Delete(cacheKeyPrefix+locale, labelsCacheKey(locale))
+	return nil
+}
+
+func checkTranslatable(locale string) error {
+	if locale == Default || supported(locale) != locale {
+		return fmt.Errorf("%w: locale must be one of %s other than %s", ErrNotTranslatable, strings.Join(Supported, ", "), Default)
+	}
+	return nil
+}
+
+func getFromDbAndCache(locale string) (*Translations, error) {
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	t := newTranslations(locale)
+	if err = queryTexts(db, t, "spcProductTranslationsGet", locale); err != nil {
+		return nil, err
+	}
+	if err = queryNotes(db, t, "spcProductNoteTranslationsGet", locale); err != nil {
+		return nil, err
+	}
+	if err = queryLabels(db, t, locale); err != nil {
+		return nil, err
+	}
+
+	translationsJSON, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	cache.Store(cacheKeyPrefix+locale, translationsJSON)
+
+	return t, nil
+}
+
+// getProductFromDbAndCache loads and caches the translations of one product, without specification labels.
+func getProductFromDbAndCache(locale string, guid string) (*Translations, error) {
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	t := newTranslations(locale)
+	if err = queryTexts(db, t, "spcProductTranslationGet", locale, guid); err != nil {
+		return nil, err
+	}
+	if err = queryNotes(db, t, "spcProductNoteTranslationGet", locale, guid); err != nil {
+		return nil, err
+	}
+
+	translationsJSON, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	cache.Store(productCacheKey(locale, guid), translationsJSON)
+
+	return t, nil
+}
+
+func getSpecificationLabels(locale string) (map[int]string, error) {
+	bytes, err := cache.Retrieve(labelsCacheKey(locale))
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[int]string{}
+	if bytes != nil {
+		err = json.Unmarshal(bytes, &labels)
+		return labels, err
+	}
+
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	t := newTranslations(locale)
+	if err = queryLabels(db, t, locale); err != nil {
+		return nil, err
+	}
+
+	labelsJSON, err := json.Marshal(t.SpecificationLabels)
+	if err != nil {
+		return nil, err
+	}
+	cache.Store(labelsCacheKey(locale), labelsJSON)
+
+	return t.SpecificationLabels, nil
+}
+
+func newTranslations(locale string) *Translations {
+	return &Translations{
+		Locale:              locale,
+		Products:            map[string]*Texts{},
+		Notes:               map[string]map[int]*NoteText{},
+		SpecificationLabels: map[int]string{},
+	}
+}
+
+// queryTexts adds the product texts returned by the stored procedure name to t.
+func queryTexts(db *sql.DB, t *Translations, name string, args ...interface{}) error {
+	rows, err := db.Query(fmt.Sprintf("set nocount on; exec [%s] %s", name, placeholders(args)), args...)
+	if err != nil {
+		return fmt.Errorf("%s Query failed: %s", name, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var guid string
+		texts := &Texts{}
+		if err = rows.Scan(
+			&guid,
+			&texts.Title,
+			&texts.Description,
+			&texts.DescriptionShort,
+			&texts.BodyHTML); err != nil {
+			return fmt.Errorf("%s Query Scan failed: %s", name, err)
+		}
+		t.Products[guid] = texts
+	}
+	return rows.Err()
+}
+
+// queryNotes adds the note texts returned by the stored procedure name to t.
+func queryNotes(db *sql.DB, t *Translations, name string, args ...interface{}) error {
+	rows, err := db.Query(fmt.Sprintf("set nocount on; exec [%s] %s", name, placeholders(args)), args...)
+	if err != nil {
+		return fmt.Errorf("%s Query failed: %s", name, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var guid string
+		var order int
+		n := &NoteText{}
+		if err = rows.Scan(&guid, &order, &n.NoteTitle, &n.NoteText); err != nil {
+			return fmt.Errorf("%s Query Scan failed: %s", name, err)
+		}
+		if t.Notes[guid] == nil {
+			t.Notes[guid] = map[int]*NoteText{}
+		}
+		t.Notes[guid][order] = n
+	}
+	return rows.Err()
+}
+
+func queryLabels(db *sql.DB, t *Translations, locale string) error {
+	rows, err := db.Query("set nocount on; exec [spcSpecificationTranslationsGet] ?", locale)
+	if err != nil {
+		return fmt.Errorf("spcSpecificationTranslationsGet Query failed: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var label string
+		if err = rows.Scan(&id, &label); err != nil {
+			return fmt.Errorf("spcSpecificationTranslationsGet Query Scan failed: %s", err)
+		}
+		t.SpecificationLabels[id] = label
+	}
+	return rows.Err()
+}
+
+func placeholders(args []interface{}) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+}
+
+func productCacheKey(locale string, guid string) string {
+	return cacheKeyPrefix + locale + ":" + guid
+}
+
+func labelsCacheKey(locale string) string {
+	return cacheKeyPrefix + locale + ":specificationLabels"
+}
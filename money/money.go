@@ -0,0 +1,240 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// USD . . .
+	USD = "USD"
+	// CAD . . .
+	CAD = "CAD"
+
+	// Base is the currency amounts stored without a currency are in.
+	Base = USD
+)
+
+// minorUnits holds the decimal places of each supported currency.
+var minorUnits = map[string]int{
+	USD: 2,
+	CAD: 2,
+}
+
+// Money is an exact amount in a currency, kept as a whole number of the currency's minor unit (cents).
+type Money struct {
+	units    int64
+	currency string
+}
+
+// Supported reports whether currency is a known ISO 4217 code.
+func Supported(currency string) bool {
+	_, ok := minorUnits[currency]
+	return ok
+}
+
+// New returns units minor units of currency, so New(49999, USD) is $499.99.
+func New(units int64, currency string) Money {
+	return Money{units: units, currency: currency}
+}
+
+// Parse reads a decimal amount such as "499.99" in currency. More decimal places than the currency has are
+// rejected rather than rounded.
+func Parse(s string, currency string) (Money, error) {
+	if !Supported(currency) {
+		return Money{}, fmt.Errorf("unsupported currency %q", currency)
+	}
+
+	units, ok := parseUnits(s, minorUnits[currency])
+	if !ok {
+		return Money{}, fmt.Errorf("invalid %s amount %q", currency, strings.TrimSpace(s))
+	}
+	return Money{units: units, currency: currency}, nil
+}
+
+// FromFloat rounds f to the nearest minor unit of currency. It is meant for reading legacy float values only.
+func FromFloat(f float64, currency string) Money {
+	return Money{units: int64(math.Round(f * math.Pow10(minorUnits[currency]))), currency: currency}
+}
+
+// Units . . .
+func (m Money) Units() int64 {
+	return m.units
+}
+
+// Currency . . .
+func (m Money) Currency() string {
+	return m.currency
+}
+
+// IsZero . . .
+func (m Money) IsZero() bool {
+	return m.units == 0
+}
+
+// IsNegative . . .
+func (m Money) IsNegative() bool {
+	return m.units < 0
+}
+
+// Equal reports whether m and o are the same amount in the same currency.
+func (m Money) Equal(o Money) bool {
+	return m.units == o.units && m.currency == o.currency
+}
+
+// Less reports whether m is smaller than o. Amounts in different currencies are not comparable, so it
+// panics rather than give a wrong answer.
+func (m Money) Less(o Money) bool {
+	if m.currency != o.currency {
+		panic(fmt.Sprintf("money: comparing %s with %s", m.currency, o.currency))
+	}
+	return m.units < o.units
+}
+
+// Convert returns m in currency at rate, rounded to the nearest minor unit of currency.
+func (m Money) Convert(rate float64, currency string) Money {
+	return Money{units: int64(math.Round(m.Float64() * rate * math.Pow10(minorUnits[currency]))), currency: currency}
+}
+
+// Float64 returns the amount in major units, for output formats that need a plain number.
+func (m Money) Float64() float64 {
+	return float64(m.units) / math.Pow10(minorUnits[m.currency])
+}
+
+// String returns the amount with the currency's decimal places and no currency, e.g. "499.99".
+func (m Money) String() string {
+	return formatUnits(m.units, minorUnits[m.currency])
+}
+
+// Format returns the amount followed by its currency code, e.g. "499.99 USD".
+func (m Money) Format() string {
+	return m.String() + " " + m.currency
+}
+
+type moneyJSON struct {
+	Amount   json.Number `json:"amount"`
+	Currency string      `json:"currency"`
+}
+
+// MarshalJSON writes {"amount":"499.99","currency":"USD"}. The amount is a string so that clients do not
+// read it into a float by accident.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.String(), m.currency})
+}
+
+// UnmarshalJSON accepts the object MarshalJSON writes, with the amount as a string or a number, or a bare
+// amount in the Base currency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	v := &moneyJSON{}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		if err := json.Unmarshal(data, v); err != nil {
+			return err
+		}
+	} else {
+		var amount json.Number
+		if err := json.Unmarshal(data, &amount); err != nil {
+			return fmt.Errorf("money must be a number or an object with amount and currency: %s", err)
+		}
+		v.Amount = amount
+	}
+	if v.Currency == "" {
+		v.Currency = Base
+	}
+
+	parsed, err := Parse(string(v.Amount), v.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan reads a decimal, money or float column. The currency is kept when already set, otherwise it is Base.
+func (m *Money) Scan(value interface{}) error {
+	currency := m.currency
+	if currency == "" {
+		currency = Base
+	}
+
+	var err error
+	switch v := value.(type) {
+	case float64:
+		*m = FromFloat(v, currency)
+	case int64:
+		*m = Money{units: v * int64(math.Pow10(minorUnits[currency])), currency: currency}
+	case []byte:
+		*m, err = parseDecimal(string(v), currency)
+	case string:
+		*m, err = parseDecimal(v, currency)
+	case nil:
+		*m = Money{currency: currency}
+	default:
+		err = fmt.Errorf("money: cannot scan %T", value)
+	}
+	return err
+}
+
+// Value writes the amount as a decimal string, which SQL Server converts to the column's type.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// parseDecimal reads a decimal column, which may carry more places than the currency (money has four),
+// rounding any extra ones.
+func parseDecimal(s string, currency string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "."); i >= 0 {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	if parsed, err := Parse(s, currency); err == nil {
+		return parsed, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("money: cannot read %q", s)
+	}
+	return FromFloat(f, currency), nil
+}
+
+// parseUnits reads a decimal amount with at most places decimal places as a whole number of minor units.
+func parseUnits(s string, places int) (int64, bool) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	whole, fraction := strings.TrimPrefix(s, "-"), ""
+	if i := strings.Index(whole, "."); i >= 0 {
+		whole, fraction = whole[:i], whole[i+1:]
+	}
+	if whole == "" && fraction == "" || len(fraction) > places || strings.ContainsAny(whole+fraction, "+-") {
+		return 0, false
+	}
+
+	digits := whole + fraction + strings.Repeat("0", places-len(fraction))
+	units, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if negative {
+		units = -units
+	}
+	return units, true
+}
+
+// formatUnits writes a whole number of minor units as a decimal amount with places decimal places.
+func formatUnits(units int64, places int) string {
+	sign := ""
+	if units < 0 {
+		sign, units = "-", -units
+	}
+	digits := fmt.Sprintf("%0*d", places+1, units)
+	if places == 0 {
+		return sign + digits
+	}
+	return sign + digits[:len(digits)-places] + "." + digits[len(digits)-places:]
+}
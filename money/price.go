@@ -0,0 +1,101 @@
+package money
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// amountPlaces is the most decimal places of any supported currency, the precision an Amount is kept at.
+const amountPlaces = 2
+
+// Price is a price as two fields of the JSON object it is embedded in: the amount as a number in "price" and
+// its currency in "currency". The API types with a price embed it, so every response writes prices the same
+// way. The zero Price has no amount, written as "price": null.
+type Price struct {
+	Amount   Amount `json:"price"`
+	Currency string `json:"currency,omitempty"`
+}
+
+// Amount is an exact decimal amount without its currency, written as a JSON number, or null when not set.
+type Amount struct {
+	units int64
+	set   bool
+}
+
+// PriceOf . . .
+func PriceOf(m Money) Price {
+	return Price{Amount: AmountOf(m), Currency: m.currency}
+}
+
+// AmountOf returns the amount of m without its currency.
+func AmountOf(m Money) Amount {
+	return Amount{units: m.units * int64(math.Pow10(amountPlaces-minorUnits[m.currency])), set: true}
+}
+
+// Money returns the price as Money. A price without a currency is in Base.
+func (p Price) Money() Money {
+	return p.Amount.In(p.Currency)
+}
+
+// IsSet reports whether the price has an amount.
+func (p Price) IsSet() bool {
+	return p.Amount.set
+}
+
+// Scan reads a decimal, money or float column as Scan on Money does, in p's currency or Base. NULL leaves the
+// price without an amount.
+func (p *Price) Scan(value interface{}) error {
+	if value == nil {
+		*p = Price{Currency: p.Currency}
+		return nil
+	}
+	m := Money{currency: p.Currency}
+	if err := m.Scan(value); err != nil {
+		return err
+	}
+	*p = PriceOf(m)
+	return nil
+}
+
+// In returns the amount as Money in currency, or in Base when currency is empty.
+func (a Amount) In(currency string) Money {
+	if currency == "" {
+		currency = Base
+	}
+	return Money{units: a.units / int64(math.Pow10(amountPlaces-minorUnits[currency])), currency: currency}
+}
+
+// IsSet . . .
+func (a Amount) IsSet() bool {
+	return a.set
+}
+
+// MarshalJSON writes the amount as a number with amountPlaces decimal places, or null when it is not set.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	if !a.set {
+		return []byte("null"), nil
+	}
+	return []byte(formatUnits(a.units, amountPlaces)), nil
+}
+
+// UnmarshalJSON reads a number, or a number in a string, with at most amountPlaces decimal places.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := strings.TrimSpace(string(data))
+	if s == "null" {
+		*a = Amount{}
+		return nil
+	}
+
+	var amount json.Number
+	if err := json.Unmarshal(data, &amount); err != nil {
+		return fmt.Errorf("price must be a number: %s", err)
+	}
+	units, ok := parseUnits(string(amount), amountPlaces)
+	if !ok {
+		return fmt.Errorf("price %s is not an amount with at most %d decimal places", amount, amountPlaces)
+	}
+	*a = Amount{units: units, set: true}
+	return nil
+}
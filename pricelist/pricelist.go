@@ -0,0 +1,197 @@
+package pricelist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/cache"
+	"github.com/wilsonelectronics/productsapi/data"
+	"github.com/wilsonelectronics/productsapi/money"
+)
+
+const (
+	cacheKeyPrefix     = "prices:"
+	rateVariablePrefix = "EXCHANGE_RATE_"
+)
+
+var (
+	// ErrNotFound . . .
+	ErrNotFound = errors.New("product not found")
+	// ErrInvalidPrice . . .
+	ErrInvalidPrice = errors.New("invalid list price")
+)
+
+// List is the prices of one sales region, all in the region's currency.
+type List struct {
+	Region   string `json:"region"`
+	Currency string `json:"currency"`
+}
+
+// Lists holds every price list. The US list is the product's own price, the others are stored per product.
+var Lists = []*List{
+	{Region: "US", Currency: money.USD},
+	{Region: "CA", Currency: money.CAD},
+}
+
+// Prices is the price list in one currency: the prices listed for products, and the exchange rate from
+// money.Base that prices the products that are not listed.
+type Prices struct {
+	Currency string
+	Rate     float64
+	Listed   map[string]money.Money
+}
+
+// Price returns the listed price of the product with guid, or base converted at the list's rate when the
+// list has none for it.
+func (p *Prices) Price(guid string, base money.Price) money.Price {
+	if price, ok := p.Listed[guid]; ok {
+		return money.PriceOf(price)
+	}
+	return p.convert(base)
+}
+
+// VariantPrice returns base, the price of a variant of the product with guid, in the list's currency. Variants
+// are not listed themselves, so base is converted at the rate between the product's listed price and
+// productBase, its own price, or at the list's rate when the product is not listed.
+func (p *Prices) VariantPrice(guid string, productBase money.Price, base money.Price) money.Price {
+	listed, ok := p.Listed[guid]
+	productMoney, baseMoney := productBase.Money(), base.Money()
+	if !ok || productMoney.IsZero() || productMoney.Currency() != baseMoney.Currency() {
+		return p.convert(base)
+	}
+	return money.PriceOf(money.New(int64(math.Round(float64(baseMoney.Units())*float64(listed.Units())/float64(productMoney.Units()))), listed.Currency()))
+}
+
+func (p *Prices) convert(base money.Price) money.Price {
+	if !base.IsSet() || base.Money().Currency() == p.Currency {
+		return base
+	}
+	return money.PriceOf(base.Money().Convert(p.Rate, p.Currency))
+}
+
+// ForCurrency returns the list priced in currency, case insensitively. An empty currency selects the list
+// of money.Base.
+func ForCurrency(currency string) (*List, error) {
+	if currency == "" {
+		currency = money.Base
+	}
+	currency = strings.ToUpper(currency)
+	for _, l := range Lists {
+		if l.Currency == currency {
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("no price list in currency %q", currency)
+}
+
+// Get returns the prices of the list in currency. The money.Base list is the products' own price, so it lists
+// none. The other lists need the rate from money.Base in EXCHANGE_RATE_<currency>, e.g. EXCHANGE_RATE_CAD,
+// to price the products they do not list.
+func Get(currency string) (*Prices, error) {
+	if currency == "" || currency == money.Base {
+		return &Prices{Currency: money.Base, Rate: 1, Listed: map[string]money.Money{}}, nil
+	}
+
+	rate, err := strconv.ParseFloat(os.Getenv(rateVariablePrefix+currency), 64)
+	if err != nil || rate <= 0 {
+		return nil, fmt.Errorf("%s%s must be set to the exchange rate from %s", rateVariablePrefix, currency, money.Base)
+	}
+	prices := &Prices{Currency: currency, Rate: rate, Listed: map[string]money.Money{}}
+
+	bytes, err := cache.Retrieve(cacheKeyPrefix + currency)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes == nil {
+		prices.Listed, err = getFromDbAndCache(currency)
+		return prices, err
+	}
+
+	err = json.Unmarshal(bytes, &prices.Listed)
+	return prices, err
+}
+
+// SetPrice lists the product with handle at price, which must be in the currency of a list other than the
+// money.Base one.
+func SetPrice(handle string, price money.Money) error {
+	if _, err := ForCurrency(price.Currency()); err != nil || price.Currency() == money.Base {
+		return fmt.Errorf("%w: prices can only be listed in %s", ErrInvalidPrice, strings.Join(otherCurrencies(), ", "))
+	}
+	if price.IsNegative() {
+		return fmt.Errorf("%w: price cannot be negative", ErrInvalidPrice)
+	}
+	return setPrice("spcProductListPriceSet", handle, price.Currency(), price)
+}
+
+// RemovePrice drops the product with handle from the list in currency, so the base price applies again.
+func RemovePrice(handle string, currency string) error {
+	return setPrice("spcProductListPriceDelete", handle, currency)
+}
+
+func setPrice(proc string, handle string, currency string, args ...interface{}) error {
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(fmt.Sprintf("set nocount off; exec [%s] %s", proc, strings.TrimSuffix(strings.Repeat("?, ", len(args)+2), ", ")),
+		append([]interface{}{handle, currency}, args...)...)
+	if err != nil {
+		return fmt.Errorf("%s failed: %s", proc, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	cache.Delete(cacheKeyPrefix + currency)
+	return nil
+}
+
+func getFromDbAndCache(currency string) (map[string]money.Money, error) {
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("set nocount on; exec [spcProductListPricesGet] ?", currency)
+	if err != nil {
+		return nil, fmt.Errorf("spcProductListPricesGet Query failed: %s", err)
+	}
+	defer rows.Close()
+
+	prices := map[string]money.Money{}
+	for rows.Next() {
+		var guid string
+		price := money.New(0, currency)
+		if err = rows.Scan(&guid, &price); err != nil {
+			return nil, fmt.Errorf("spcProductListPricesGet Query Scan failed: %s", err)
+		}
+		prices[guid] = price
+	}
+
+	pricesJSON, err := json.Marshal(prices)
+	if err != nil {
+		return nil, err
+	}
+	cache.Store(cacheKeyPrefix+currency, pricesJSON)
+
+	return prices, nil
+}
+
+func otherCurrencies() []string {
+	currencies := []string{}
+	for _, l := range Lists {
+		if l.Currency != money.Base {
+			currencies = append(currencies, l.Currency)
+		}
+	}
+	return currencies
+}
@@ -0,0 +1,96 @@
+package product
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/wilsonelectronics/productsapi/cache"
+	"github.com/wilsonelectronics/productsapi/money"
+)
+
+const (
+	activeCacheKey = cache.ActiveProductsKey
+	// The active products come from walking the whole catalog, so like the merchant feed they are kept
+	// longer than other cached values.
+	activeCacheTTL = 15 * time.Minute
+)
+
+// ActiveProduct is what lookups over the whole catalog, such as the compatibility checker and the product
+// selector, need of an active product. Specifications holds its active specifications in their order, and
+// Tags its active tags.
+type ActiveProduct struct {
+	GUID   string `json:"guid"`
+	Handle string `json:"handle"`
+	SKU    string `json:"sku"`
+	Title  string `json:"title"`
+	money.Price
+	ImageURL       string                 `json:"imageURL"`
+	Specifications []*ActiveSpecification `json:"specifications"`
+	Tags           []string               `json:"tags"`
+}
+
+// ActiveSpecification is a specification of an active product. Labels are not unique, so lookups by label
+// go through every specification with it.
+type ActiveSpecification struct {
+	ID    int    `json:"id"`
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// GetActiveProducts returns every product that is active and not deleted.
+func GetActiveProducts() ([]*ActiveProduct, error) {
+	bytes, err := cache.Retrieve(activeCacheKey)
+	if err != nil {
+		return nil, err
+	}
+
+	products := []*ActiveProduct{}
+	if bytes != nil {
+		err = json.Unmarshal(bytes, &products)
+		return products, err
+	}
+
+	err = Walk(func(p *Product) error {
+		d := p.Details
+		if d == nil || !d.IsActive || d.IsDeleted {
+			return nil
+		}
+
+		a := &ActiveProduct{
+			GUID:           p.GUID,
+			Handle:         d.Handle,
+			SKU:            p.SKU,
+			Title:          d.Title,
+			Price:          d.Price,
+			ImageURL:       d.ImageURL,
+			Specifications: []*ActiveSpecification{},
+			Tags:           []string{},
+		}
+		for _, s := range p.Specifications {
+			if s.IsActive {
+				a.Specifications = append(a.Specifications, &ActiveSpecification{
+					ID:    s.SpecificationID,
+					Label: s.SpecificationLabel,
+					Value: s.FieldValue})
+			}
+		}
+		for _, t := range p.Tags {
+			if t.IsActive {
+				a.Tags = append(a.Tags, t.Tag)
+			}
+		}
+		products = append(products, a)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	productsJSON, err := json.Marshal(products)
+	if err != nil {
+		return nil, err
+	}
+	cache.StoreFor(activeCacheKey, productsJSON, activeCacheTTL)
+
+	return products, nil
+}
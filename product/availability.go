@@ -0,0 +1,22 @@
+package product
+
+import "github.com/wilsonelectronics/productsapi/inventory"
+
+// setAvailability adds the availability of p and of its variants from the current inventory. It is not cached
+// with the product, so stock updates show without dropping cached products.
+func setAvailability(p *Product) error {
+	skus := []string{p.SKU}
+	for _, v := range p.Variants {
+		skus = append(skus, v.SKU)
+	}
+	inv, err := inventory.Get(skus...)
+	if err != nil {
+		return err
+	}
+
+	p.Availability = inv.Availability(p.SKU)
+	for _, v := range p.Variants {
+		v.Availability = inv.Availability(v.SKU)
+	}
+	return nil
+}
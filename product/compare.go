@@ -0,0 +1,145 @@
+package product
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/wilsonelectronics/productsapi/money"
+	"github.com/wilsonelectronics/productsapi/spec"
+)
+
+const (
+	// MinCompareProducts . . .
+	MinCompareProducts = 2
+	// MaxCompareProducts . . .
+	MaxCompareProducts = 4
+)
+
+// Comparison lines up the specifications of several products. Every row's Values are in the same order as
+// Products, with nil where a product lacks that specification.
+type Comparison struct {
+	Products       []*comparedProduct       `json:"products"`
+	Specifications []*comparedSpecification `json:"specifications"`
+	PriceDiffers   bool                     `json:"priceDiffers"`
+	KitsDiffer     bool                     `json:"kitsDiffer"`
+}
+
+type comparedProduct struct {
+	GUID     string `json:"guid"`
+	SKU      string `json:"sku"`
+	Handle   string `json:"handle"`
+	Title    string `json:"title"`
+	ImageURL string `json:"imageURL"`
+	money.Price
+	Kits []*kit `json:"kits"`
+}
+
+type comparedSpecification struct {
+	SpecificationLabel string                  `json:"specificationLabel"`
+	Values             []*productSpecification `json:"values"`
+	Differs            bool                    `json:"differs"`
+}
+
+// Compare lines up the products with handles, priced and localized as opts ask. opts.Include and opts.Fields
+// are ignored.
+func Compare(handles []string, opts *Options) (*Comparison, error) {
+	if opts != nil {
+		opts = &Options{Currency: opts.Currency, Locale: opts.Locale}
+	}
+
+	if len(handles) < MinCompareProducts || len(handles) > MaxCompareProducts {
+		return nil, fmt.Errorf("between %d and %d products can be compared, got %d", MinCompareProducts, MaxCompareProducts, len(handles))
+	}
+
+	products := make([]*Product, len(handles))
+	errs := make([]error, len(handles))
+	var wg sync.WaitGroup
+	wg.Add(len(handles))
+	for i, h := range handles {
+		go func(i int, h string) {
+			defer wg.Done()
+			products[i], errs[i] = GetByHandleWithOptions(h, opts)
+		}(i, h)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("could not load product %s: %s", handles[i], err)
+		}
+	}
+
+	return compare(products), nil
+}
+
+func compare(products []*Product) *Comparison {
+	c := &Comparison{Products: []*comparedProduct{}, Specifications: []*comparedSpecification{}}
+	rows := map[string]*comparedSpecification{}
+	for i, p := range products {
+		c.Products = append(c.Products, &comparedProduct{
+			GUID:     p.GUID,
+			SKU:      p.SKU,
+			Handle:   p.Details.Handle,
+			Title:    p.Details.Title,
+			ImageURL: p.Details.ImageURL,
+			Price:    p.Details.Price,
+			Kits:     p.Kits})
+
+		for _, s := range p.Specifications {
+			if !s.IsActive {
+				continue
+			}
+			key := strings.ToLower(s.SpecificationLabel)
+			row, ok := rows[key]
+			if !ok {
+				row = &comparedSpecification{SpecificationLabel: s.SpecificationLabel, Values: make([]*productSpecification, len(products))}
+				rows[key] = row
+				c.Specifications = append(c.Specifications, row)
+			}
+			if row.Values[i] == nil {
+				row.Values[i] = s
+			}
+		}
+	}
+
+	for _, row := range c.Specifications {
+		for _, v := range row.Values[1:] {
+			if !sameSpecificationValue(row.Values[0], v) {
+				row.Differs = true
+				break
+			}
+		}
+	}
+
+	for _, p := range c.Products[1:] {
+		if !p.Price.Money().Equal(c.Products[0].Price.Money()) {
+			c.PriceDiffers = true
+		}
+		if kitContents(p.Kits) != kitContents(c.Products[0].Kits) {
+			c.KitsDiffer = true
+		}
+	}
+
+	return c
+}
+
+func sameSpecificationValue(a, b *productSpecification) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Value != nil && b.Value != nil && a.Value.Type != spec.TypeText && b.Value.Type != spec.TypeText {
+		return a.Value.Equal(b.Value)
+	}
+	return strings.EqualFold(strings.TrimSpace(a.FieldValue), strings.TrimSpace(b.FieldValue))
+}
+
+func kitContents(kits []*kit) string {
+	items := []string{}
+	for _, k := range kits {
+		items = append(items, strings.ToLower(k.KitItemName))
+	}
+	sort.Strings(items)
+	return strings.Join(items, "|")
+}
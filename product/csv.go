@@ -0,0 +1,425 @@
+package product
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/money"
+
+	"github.com/piotrkowalczuk/ntypes"
+)
+
+// Catalog CSV columns. Child collections are written in a single cell, with items separated by "|" and the
+// fields of an item by ";". A "|", ";" or "\" within a field is escaped with a "\":
+//
+//	tags            tagId;isActive                   3;true|7;false
+//	kits            name;sku;iconURL;linkURL         Power Supply;PS-1;https://…/ps.png
+//	media           see below                        1;https://…/front.jpg;Front;;1200;800;;;;;true
+//	notes           noteTypeId;title;text            2;Warranty;Two years\; parts only
+//	specifications  specificationId=value;isActive   4=72 dB;true|9=Band 2, 4, 5;true
+//	vendors         vendorId;url;price;currency;stockStatus;checkedTime
+//	                                                 3;https://vendor.example/booster;499.99;USD;inStock
+//	relatedProducts handle;relationshipType          drive-reach;upgrade|drive-x
+//
+// A media item is mediaTypeId;linkURL;title;logoURL;width;height;durationSeconds;fileSize;contentType;language;
+// isActive. Trailing empty fields are left off, and an empty isActive reads as true.
+const (
+	handleColumn           = "handle"
+	skuColumn              = "sku"
+	productTypeIDColumn    = "productTypeId"
+	upcColumn              = "upc"
+	titleColumn            = "title"
+	titleTagColumn         = "titleTag"
+	descriptionColumn      = "description"
+	descriptionShortColumn = "descriptionShort"
+	bodyHTMLColumn         = "bodyHtml"
+	priceColumn            = "price"
+	imageURLColumn         = "imageURL"
+	isActiveColumn         = "isActive"
+)
+
+const (
+	itemSeparator  = "|"
+	fieldSeparator = ";"
+)
+
+var fieldEscaper = strings.NewReplacer(`\`, `\\`, itemSeparator, `\`+itemSeparator, fieldSeparator, `\`+fieldSeparator)
+
+// CSVColumns lists every column of the catalog CSV layout in order.
+var CSVColumns = []string{
+	handleColumn,
+	skuColumn,
+	productTypeIDColumn,
+	upcColumn,
+	titleColumn,
+	titleTagColumn,
+	descriptionColumn,
+	descriptionShortColumn,
+	bodyHTMLColumn,
+	priceColumn,
+	imageURLColumn,
+	isActiveColumn,
+	tagsCollection,
+	kitsCollection,
+	mediaCollection,
+	notesCollection,
+	specificationsCollection,
+	vendorsCollection,
+	relatedProductsCollection,
+}
+
+// setCSVValue sets the field behind column from its CSV cell.
+func setCSVValue(p *Product, column, value string) error {
+	value = strings.TrimSpace(value)
+	switch column {
+	case handleColumn:
+		p.Details.Handle = value
+	case skuColumn:
+		p.SKU = value
+	case productTypeIDColumn:
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("productTypeId %q is not a number", value)
+		}
+		p.ProductTypeID = id
+	case upcColumn:
+		p.UPC = value
+	case titleColumn:
+		p.Details.Title = value
+	case titleTagColumn:
+		p.Details.TitleTag = nullString(value)
+	case descriptionColumn:
+		p.Details.Description = nullString(value)
+	case descriptionShortColumn:
+		p.Details.DescriptionShort = nullString(value)
+	case bodyHTMLColumn:
+		p.Details.BodyHTML = nullString(value)
+	case priceColumn:
+		price, err := money.Parse(strings.TrimPrefix(value, "$"), money.Base)
+		if err != nil {
+			return fmt.Errorf("price %q is not an amount in %s", value, money.Base)
+		}
+		p.Details.Price = money.PriceOf(price)
+	case imageURLColumn:
+		p.Details.ImageURL = value
+	case isActiveColumn:
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("isActive %q is not true or false", value)
+		}
+		p.Details.IsActive = active
+	case tagsCollection:
+		p.Tags = []*productTag{}
+		for _, item := range splitItems(value) {
+			item = pad(item, 2)
+			id, err := strconv.Atoi(item[0])
+			if err != nil {
+				return fmt.Errorf("tag %q is not a number", item[0])
+			}
+			t := &productTag{TagID: id}
+			if t.IsActive, err = parseActive("tag", item[1]); err != nil {
+				return err
+			}
+			p.Tags = append(p.Tags, t)
+		}
+	case kitsCollection:
+		p.Kits = []*kit{}
+		for i, item := range splitItems(value) {
+			item = pad(item, 4)
+			p.Kits = append(p.Kits, &kit{KitItemName: item[0], SKU: item[1], KitItemIconURL: item[2], KitItemLinkURL: nullString(item[3]), ItemOrder: i + 1})
+		}
+	case mediaCollection:
+		p.Medias = []*media{}
+		for i, item := range splitItems(value) {
+			item = pad(item, 11)
+			typeID, err := strconv.Atoi(item[0])
+			if err != nil {
+				return fmt.Errorf("media type %q is not a number", item[0])
+			}
+			m := &media{
+				MediaTypeID:  typeID,
+				MediaLinkURL: nullString(item[1]),
+				MediaTitle:   nullString(item[2]),
+				MediaLogoURL: nullString(item[3]),
+				ContentType:  nullString(item[8]),
+				Language:     nullString(item[9]),
+				MediaOrder:   i + 1,
+			}
+			if m.Width, err = nullInt32("media width", item[4]); err != nil {
+				return err
+			}
+			if m.Height, err = nullInt32("media height", item[5]); err != nil {
+				return err
+			}
+			if m.DurationSeconds, err = nullInt32("media durationSeconds", item[6]); err != nil {
+				return err
+			}
+			if m.FileSize, err = nullInt64("media fileSize", item[7]); err != nil {
+				return err
+			}
+			if m.IsActive, err = parseActive("media", item[10]); err != nil {
+				return err
+			}
+			p.Medias = append(p.Medias, m)
+		}
+	case notesCollection:
+		p.Notes = []*note{}
+		for i, item := range splitItems(value) {
+			item = pad(item, 3)
+			typeID, err := strconv.Atoi(item[0])
+			if err != nil {
+				return fmt.Errorf("note type %q is not a number", item[0])
+			}
+			p.Notes = append(p.Notes, &note{NoteTypeID: typeID, NoteTitle: nullString(item[1]), NoteText: nullString(item[2]), NoteOrder: i + 1})
+		}
+	case specificationsCollection:
+		p.Specifications = []*productSpecification{}
+		for _, item := range splitItems(value) {
+			item = pad(item, 2)
+			parts := strings.SplitN(item[0], "=", 2)
+			id, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+			if err != nil || len(parts) != 2 {
+				return fmt.Errorf("specification %q must be written as id=value", item[0])
+			}
+			s := &productSpecification{SpecificationID: id, FieldValue: strings.TrimSpace(parts[1])}
+			if s.IsActive, err = parseActive("specification", item[1]); err != nil {
+				return err
+			}
+			p.Specifications = append(p.Specifications, s)
+		}
+	case vendorsCollection:
+		p.Vendors = []*productVendor{}
+		for _, item := range splitItems(value) {
+			item = pad(item, 6)
+			id, err := strconv.Atoi(item[0])
+			if err != nil {
+				return fmt.Errorf("vendor %q is not a number", item[0])
+			}
+			v := &productVendor{VendorID: id, ProductVendorURL: item[1], StockStatus: item[4], LastCheckedTime: nullString(item[5])}
+			if item[2] != "" {
+				currency := item[3]
+				if currency == "" {
+					currency = money.Base
+				}
+				price, err := money.Parse(item[2], currency)
+				if err != nil {
+					return fmt.Errorf("vendor %d price %q is not an amount in %s", id, item[2], currency)
+				}
+				v.Price = money.PriceOf(price)
+			}
+			p.Vendors = append(p.Vendors, v)
+		}
+	case relatedProductsCollection:
+		p.RelatedProducts = []*relatedProduct{}
+		for _, item := range splitItems(value) {
+			item = pad(item, 2)
+			p.RelatedProducts = append(p.RelatedProducts, &relatedProduct{Handle: item[0], RelationshipType: item[1]})
+		}
+	default:
+		return fmt.Errorf("unknown column %q", column)
+	}
+	return nil
+}
+
+// csvValue writes the field behind column as a CSV cell.
+func csvValue(p *Product, column string) string {
+	d := p.Details
+	if d == nil {
+		d = &details{}
+	}
+	switch column {
+	case handleColumn:
+		return d.Handle
+	case skuColumn:
+		return p.SKU
+	case productTypeIDColumn:
+		return strconv.Itoa(p.ProductTypeID)
+	case upcColumn:
+		return p.UPC
+	case titleColumn:
+		return d.Title
+	case titleTagColumn:
+		return d.TitleTag.StringOr("")
+	case descriptionColumn:
+		return d.Description.StringOr("")
+	case descriptionShortColumn:
+		return d.DescriptionShort.StringOr("")
+	case bodyHTMLColumn:
+		return d.BodyHTML.StringOr("")
+	case priceColumn:
+		return d.Price.Money().String()
+	case imageURLColumn:
+		return d.ImageURL
+	case isActiveColumn:
+		return strconv.FormatBool(d.IsActive)
+	case tagsCollection:
+		items := []string{}
+		for _, t := range p.Tags {
+			items = append(items, joinFields(strconv.Itoa(t.TagID), strconv.FormatBool(t.IsActive)))
+		}
+		return strings.Join(items, itemSeparator)
+	case kitsCollection:
+		items := []string{}
+		for _, k := range p.Kits {
+			items = append(items, joinFields(k.KitItemName, k.SKU, k.KitItemIconURL, k.KitItemLinkURL.StringOr("")))
+		}
+		return strings.Join(items, itemSeparator)
+	case mediaCollection:
+		items := []string{}
+		for _, m := range p.Medias {
+			items = append(items, joinFields(
+				strconv.Itoa(m.MediaTypeID),
+				m.MediaLinkURL.StringOr(""),
+				m.MediaTitle.StringOr(""),
+				m.MediaLogoURL.StringOr(""),
+				int32Field(m.Width),
+				int32Field(m.Height),
+				int32Field(m.DurationSeconds),
+				int64Field(m.FileSize),
+				m.ContentType.StringOr(""),
+				m.Language.StringOr(""),
+				strconv.FormatBool(m.IsActive)))
+		}
+		return strings.Join(items, itemSeparator)
+	case notesCollection:
+		items := []string{}
+		for _, n := range p.Notes {
+			items = append(items, joinFields(strconv.Itoa(n.NoteTypeID), n.NoteTitle.StringOr(""), n.NoteText.StringOr("")))
+		}
+		return strings.Join(items, itemSeparator)
+	case specificationsCollection:
+		items := []string{}
+		for _, s := range p.Specifications {
+			items = append(items, joinFields(strconv.Itoa(s.SpecificationID)+"="+s.FieldValue, strconv.FormatBool(s.IsActive)))
+		}
+		return strings.Join(items, itemSeparator)
+	case vendorsCollection:
+		items := []string{}
+		for _, v := range p.Vendors {
+			price, currency := "", ""
+			if v.Price.IsSet() {
+				price, currency = v.Price.Money().String(), v.Price.Money().Currency()
+			}
+			items = append(items, joinFields(strconv.Itoa(v.VendorID), v.ProductVendorURL, price, currency, v.StockStatus, v.LastCheckedTime.StringOr("")))
+		}
+		return strings.Join(items, itemSeparator)
+	case relatedProductsCollection:
+		items := []string{}
+		for _, rp := range p.RelatedProducts {
+			items = append(items, joinFields(rp.Handle, rp.RelationshipType))
+		}
+		return strings.Join(items, itemSeparator)
+	}
+	return ""
+}
+
+// splitItems splits a child collection cell into its items and their fields, undoing the escapes joinFields
+// adds.
+func splitItems(value string) [][]string {
+	items := [][]string{}
+	fields := []string{}
+	var field strings.Builder
+	escaped := false
+	endItem := func() {
+		fields = append(fields, strings.TrimSpace(field.String()))
+		field.Reset()
+		if len(fields) > 1 || fields[0] != "" {
+			items = append(items, fields)
+		}
+		fields = []string{}
+	}
+	for _, r := range value {
+		switch {
+		case escaped:
+			field.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case string(r) == fieldSeparator:
+			fields = append(fields, strings.TrimSpace(field.String()))
+			field.Reset()
+		case string(r) == itemSeparator:
+			endItem()
+		default:
+			field.WriteRune(r)
+		}
+	}
+	endItem()
+	return items
+}
+
+// joinFields writes the fields of an item, escaping the separators within them and leaving off trailing empty
+// fields.
+func joinFields(fields ...string) string {
+	for len(fields) > 0 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	escaped := make([]string, len(fields))
+	for i, f := range fields {
+		escaped[i] = fieldEscaper.Replace(f)
+	}
+	return strings.Join(escaped, fieldSeparator)
+}
+
+func pad(fields []string, n int) []string {
+	for len(fields) < n {
+		fields = append(fields, "")
+	}
+	return fields
+}
+
+func nullString(s string) ntypes.String {
+	if s == "" {
+		return ntypes.String{}
+	}
+	return ntypes.String{Chars: s, Valid: true}
+}
+
+func nullInt32(name, s string) (ntypes.Int32, error) {
+	if s == "" {
+		return ntypes.Int32{}, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return ntypes.Int32{}, fmt.Errorf("%s %q is not a number", name, s)
+	}
+	return ntypes.Int32{Int32: int32(n), Valid: true}, nil
+}
+
+func nullInt64(name, s string) (ntypes.Int64, error) {
+	if s == "" {
+		return ntypes.Int64{}, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return ntypes.Int64{}, fmt.Errorf("%s %q is not a number", name, s)
+	}
+	return ntypes.Int64{Int64: n, Valid: true}, nil
+}
+
+func int32Field(n ntypes.Int32) string {
+	if !n.Valid {
+		return ""
+	}
+	return strconv.FormatInt(int64(n.Int32), 10)
+}
+
+func int64Field(n ntypes.Int64) string {
+	if !n.Valid {
+		return ""
+	}
+	return strconv.FormatInt(n.Int64, 10)
+}
+
+// parseActive reads the isActive field of a child item, which is true when left empty.
+func parseActive(name, s string) (bool, error) {
+	if s == "" {
+		return true, nil
+	}
+	active, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("%s isActive %q is not true or false", name, s)
+	}
+	return active, nil
+}
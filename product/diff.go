@@ -0,0 +1,170 @@
+package product
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/changefeed"
+)
+
+// changedFields compares old with p field by field. Child collections that are nil in p are left out since
+// writing p keeps them unchanged. A nil old means p is new, so every field it sets is reported.
+func changedFields(old, p *Product) []*changefeed.Change {
+	if old == nil {
+		old = &Product{Details: &details{}}
+	}
+	if old.Details == nil {
+		old.Details = &details{}
+	}
+	changes := []*changefeed.Change{}
+	add := func(field string, o, n interface{}) {
+		oJSON, _ := json.Marshal(o)
+		nJSON, _ := json.Marshal(n)
+		if string(oJSON) != string(nJSON) {
+			changes = append(changes, &changefeed.Change{Field: field, Old: o, New: n})
+		}
+	}
+
+	add("sku", old.SKU, p.SKU)
+	add("productTypeId", old.ProductTypeID, p.ProductTypeID)
+	add("upc", old.UPC, p.UPC)
+	if p.Details != nil {
+		add("details.title", old.Details.Title, p.Details.Title)
+		add("details.titleTag", old.Details.TitleTag.StringOr(""), p.Details.TitleTag.StringOr(""))
+		add("details.description", old.Details.Description.StringOr(""), p.Details.Description.StringOr(""))
+		add("details.descriptionShort", old.Details.DescriptionShort.StringOr(""), p.Details.DescriptionShort.StringOr(""))
+		add("details.body_HTML", old.Details.BodyHTML.StringOr(""), p.Details.BodyHTML.StringOr(""))
+		add("details.price", old.Details.Price, p.Details.Price)
+		add("details.imageURL", old.Details.ImageURL, p.Details.ImageURL)
+		add("details.handle", old.Details.Handle, p.Details.Handle)
+		add("details.isActive", old.Details.IsActive, p.Details.IsActive)
+	}
+
+	if p.Tags != nil {
+		add("tags", tagSummary(old.Tags), tagSummary(p.Tags))
+	}
+	if p.Kits != nil {
+		add("kits", kitSummary(old.Kits), kitSummary(p.Kits))
+	}
+	if p.Medias != nil {
+		add("media", mediaSummary(old.Medias), mediaSummary(p.Medias))
+	}
+	if p.Notes != nil {
+		add("notes", noteSummary(old.Notes), noteSummary(p.Notes))
+	}
+	if p.Specifications != nil {
+		add("specifications", specificationSummary(old.Specifications), specificationSummary(p.Specifications))
+	}
+	if p.Vendors != nil {
+		add("vendors", vendorSummary(old.Vendors), vendorSummary(p.Vendors))
+	}
+	if p.RelatedProducts != nil {
+		add("relatedProducts", relatedProductSummary(old.RelatedProducts), relatedProductSummary(p.RelatedProducts))
+	}
+	if p.OptionGroups != nil {
+		add("optionGroups", optionGroupSummary(old.OptionGroups), optionGroupSummary(p.OptionGroups))
+	}
+	if p.Variants != nil {
+		add("variants", variantSummary(old.Variants), variantSummary(p.Variants))
+	}
+
+	return changes
+}
+
+// The summaries below describe a child collection by its content, ignoring row GUIDs and order so that
+// rewriting identical rows is not reported as a change.
+
+func tagSummary(tags []*productTag) []string {
+	s := []string{}
+	for _, t := range tags {
+		s = append(s, strconv.Itoa(t.TagID))
+	}
+	return sorted(s)
+}
+
+func kitSummary(kits []*kit) []string {
+	s := []string{}
+	for _, k := range kits {
+		s = append(s, strings.Join([]string{k.KitItemName, k.SKU, k.KitItemIconURL, k.KitItemLinkURL.StringOr("")}, ";"))
+	}
+	return sorted(s)
+}
+
+func mediaSummary(medias []*media) []string {
+	s := []string{}
+	for _, m := range medias {
+		s = append(s, strings.Join([]string{
+			strconv.Itoa(m.MediaTypeID),
+			m.MediaLinkURL.StringOr(""),
+			m.MediaTitle.StringOr(""),
+			fmt.Sprintf("%dx%d", m.Width.Int32Or(0), m.Height.Int32Or(0)),
+			strconv.Itoa(int(m.DurationSeconds.Int32Or(0))),
+			strconv.FormatInt(m.FileSize.Int64Or(0), 10),
+			m.ContentType.StringOr(""),
+			m.Language.StringOr(""),
+		}, ";"))
+	}
+	return sorted(s)
+}
+
+func noteSummary(notes []*note) []string {
+	s := []string{}
+	for _, n := range notes {
+		s = append(s, strings.Join([]string{strconv.Itoa(n.NoteTypeID), n.NoteTitle.StringOr(""), n.NoteText.StringOr("")}, ";"))
+	}
+	return sorted(s)
+}
+
+func specificationSummary(specifications []*productSpecification) []string {
+	s := []string{}
+	for _, spec := range specifications {
+		s = append(s, strconv.Itoa(spec.SpecificationID)+"="+spec.FieldValue)
+	}
+	return sorted(s)
+}
+
+func vendorSummary(vendors []*productVendor) []string {
+	s := []string{}
+	for _, v := range vendors {
+		s = append(s, strconv.Itoa(v.VendorID)+";"+v.ProductVendorURL)
+	}
+	return sorted(s)
+}
+
+func relatedProductSummary(relatedProducts []*relatedProduct) []string {
+	s := []string{}
+	for _, rp := range relatedProducts {
+		s = append(s, rp.Handle+";"+rp.RelationshipType)
+	}
+	return sorted(s)
+}
+
+// optionGroupSummary keeps the order of groups and values, since it is the order customers see them in.
+func optionGroupSummary(groups []*optionGroup) []string {
+	s := []string{}
+	for _, g := range groups {
+		s = append(s, g.Name+"="+strings.Join(g.Values, ","))
+	}
+	return s
+}
+
+func variantSummary(variants []*Variant) []string {
+	s := []string{}
+	for _, v := range variants {
+		options := []string{}
+		for group, value := range v.Options {
+			options = append(options, group+"="+value)
+		}
+		s = append(s, strings.Join([]string{v.SKU, v.UPC.StringOr(""), v.Price.Money().String(), v.ImageURL,
+			strings.Join(sorted(options), ","), strconv.FormatBool(v.IsDefault), strconv.FormatBool(v.IsActive)}, ";"))
+	}
+	return sorted(s)
+}
+
+func sorted(s []string) []string {
+	sort.Strings(s)
+	return s
+}
@@ -0,0 +1,299 @@
+package product
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/wilsonelectronics/productsapi/data"
+	"github.com/wilsonelectronics/productsapi/strslice"
+)
+
+const (
+	// ExportCSV writes the catalog CSV layout that Import reads back.
+	ExportCSV = "csv"
+	// ExportJSONLines writes one product per line in the same shape GetProduct returns.
+	ExportJSONLines = "jsonl"
+	// ExportSpreadsheet writes a flattened CSV for spreadsheet programs: names instead of IDs and one
+	// column per specification, with a byte order mark so Excel reads it as UTF-8.
+	ExportSpreadsheet = "spreadsheet"
+)
+
+const (
+	productTypeColumn = "productType"
+	specColumnPrefix  = "spec: "
+	walkBatchSize     = 8
+)
+
+// ErrInvalidExport is returned for an unknown export format or column.
+var ErrInvalidExport = errors.New("invalid export")
+
+var spreadsheetColumns = []string{
+	handleColumn,
+	skuColumn,
+	productTypeColumn,
+	upcColumn,
+	titleColumn,
+	titleTagColumn,
+	descriptionShortColumn,
+	descriptionColumn,
+	priceColumn,
+	imageURLColumn,
+	isActiveColumn,
+	tagsCollection,
+	kitsCollection,
+	mediaCollection,
+	vendorsCollection,
+	relatedProductsCollection,
+}
+
+// ExportContentType . . .
+func ExportContentType(format string) string {
+	if format == ExportJSONLines {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Handles returns the handle of every product that has not been deleted.
+func Handles() ([]string, error) {
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("set nocount on; exec [spcProductHandlesGet]")
+	if err != nil {
+		return nil, fmt.Errorf("spcProductHandlesGet Query failed: %s", err)
+	}
+	defer rows.Close()
+
+	handles := []string{}
+	for rows.Next() {
+		var handle string
+		if err = rows.Scan(&handle); err != nil {
+			return nil, fmt.Errorf("spcProductHandlesGet Query Scan failed: %s", err)
+		}
+		handles = append(handles, handle)
+	}
+
+	return handles, nil
+}
+
+// Walk calls fn with every product that has not been deleted, in handle order, stopping at the first error.
+// Products are loaded a few at a time through the cache.
+func Walk(fn func(*Product) error) error {
+	handles, err := Handles()
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(handles); start += walkBatchSize {
+		batch := handles[start:]
+		if len(batch) > walkBatchSize {
+			batch = batch[:walkBatchSize]
+		}
+
+		products := make([]*Product, len(batch))
+		errs := make([]error, len(batch))
+		var wg sync.WaitGroup
+		wg.Add(len(batch))
+		for i, h := range batch {
+			go func(i int, h string) {
+				defer wg.Done()
+				products[i], errs[i] = GetByHandle(h)
+			}(i, h)
+		}
+		wg.Wait()
+
+		for i, p := range products {
+			if errs[i] != nil {
+				return fmt.Errorf("could not load product %s: %s", batch[i], errs[i])
+			}
+			if err = fn(p); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Export writes every product to w in format. When columns are given only those columns (CSV layouts) or
+// fields (JSON Lines) are written.
+func Export(w io.Writer, format string, columns []string) error {
+	switch format {
+	case ExportCSV:
+		if len(columns) == 0 {
+			columns = CSVColumns
+		}
+		for _, c := range columns {
+			if !strslice.Contains(CSVColumns, c) {
+				return fmt.Errorf("%w: unknown column %q", ErrInvalidExport, c)
+			}
+		}
+		return exportCSV(w, columns, csvValue)
+	case ExportJSONLines:
+		return exportJSONLines(w, &Options{Fields: columns})
+	case ExportSpreadsheet:
+		return exportSpreadsheet(w, columns)
+	}
+	return fmt.Errorf("%w: unknown format %q", ErrInvalidExport, format)
+}
+
+func exportCSV(w io.Writer, columns []string, value func(*Product, string) string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+
+	err := Walk(func(p *Product) error {
+		record := make([]string, len(columns))
+		for i, c := range columns {
+			record[i] = value(p, c)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func exportJSONLines(w io.Writer, opts *Options) error {
+	return Walk(func(p *Product) error {
+		stripDerived(p)
+		line, err := opts.Marshal(p)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(line, '\n'))
+		return err
+	})
+}
+
+// stripDerived clears the fields made for responses rather than stored, so exported lines can be imported
+// as they are.
+func stripDerived(p *Product) {
+	p.MediaGroups = nil
+	p.Availability = nil
+	if p.Details != nil {
+		p.Details.ImageSet = nil
+	}
+	for _, m := range p.Medias {
+		m.ImageSet = nil
+	}
+	for _, v := range p.Vendors {
+		v.TrackingURL, v.ClickURL = "", ""
+	}
+	for _, v := range p.Variants {
+		v.ImageSet, v.Availability = nil, nil
+	}
+}
+
+func exportSpreadsheet(w io.Writer, columns []string) error {
+	labels, err := specificationLabels()
+	if err != nil {
+		return err
+	}
+
+	available := append([]string{}, spreadsheetColumns...)
+	for _, l := range labels {
+		available = append(available, specColumnPrefix+l)
+	}
+	if len(columns) == 0 {
+		columns = available
+	}
+	for _, c := range columns {
+		if !strslice.Contains(available, c) {
+			return fmt.Errorf("%w: unknown column %q", ErrInvalidExport, c)
+		}
+	}
+
+	if _, err = io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	return exportCSV(w, columns, spreadsheetValue)
+}
+
+// spreadsheetValue is csvValue with names in place of IDs and specifications spread over their own columns.
+func spreadsheetValue(p *Product, column string) string {
+	items := []string{}
+	switch {
+	case column == productTypeColumn:
+		return p.ProductType
+	case column == tagsCollection:
+		for _, t := range p.Tags {
+			items = append(items, t.Tag)
+		}
+	case column == kitsCollection:
+		for _, k := range p.Kits {
+			items = append(items, k.KitItemName)
+		}
+	case column == mediaCollection:
+		for _, m := range p.Medias {
+			items = append(items, m.MediaLinkURL.StringOr(""))
+		}
+	case column == vendorsCollection:
+		for _, v := range p.Vendors {
+			items = append(items, v.VendorName)
+		}
+	case strings.HasPrefix(column, specColumnPrefix):
+		label := strings.TrimPrefix(column, specColumnPrefix)
+		for _, s := range p.Specifications {
+			if s.SpecificationLabel == label {
+				items = append(items, s.FieldValue)
+			}
+		}
+	default:
+		return csvValue(p, column)
+	}
+	return strings.Join(items, "\n")
+}
+
+func specificationLabels() ([]string, error) {
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("set nocount on; exec [spcSpecificationsGet]")
+	if err != nil {
+		return nil, fmt.Errorf("spcSpecificationsGet Query failed: %s", err)
+	}
+	defer rows.Close()
+
+	labels := []string{}
+	for rows.Next() {
+		var id int
+		var label string
+		if err = rows.Scan(&id, &label); err != nil {
+			return nil, fmt.Errorf("spcSpecificationsGet Query Scan failed: %s", err)
+		}
+		labels = append(labels, label)
+	}
+
+	return labels, nil
+}
+
+// ExportFileName . . .
+func ExportFileName(format string) string {
+	switch format {
+	case ExportJSONLines:
+		return "catalog.jsonl"
+	case ExportSpreadsheet:
+		return "catalog-spreadsheet.csv"
+	}
+	return "catalog.csv"
+}
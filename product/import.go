@@ -0,0 +1,266 @@
+package product
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/changefeed"
+	"github.com/wilsonelectronics/productsapi/data"
+	"github.com/wilsonelectronics/productsapi/strslice"
+)
+
+const (
+	importCreate    = "create"
+	importUpdate    = "update"
+	importUnchanged = "unchanged"
+	importInvalid   = "invalid"
+)
+
+// ImportRow is one product read from an import file.
+type ImportRow struct {
+	Line    int
+	Product *Product
+	// Columns holds the CSV columns the row set. Fields outside it keep their stored values when the
+	// product already exists. A nil Columns means the row describes the whole product.
+	Columns  []string
+	Problems []string
+}
+
+// ImportReport . . .
+type ImportReport struct {
+	DryRun    bool               `json:"dryRun"`
+	Applied   bool               `json:"applied"`
+	Created   int                `json:"created"`
+	Updated   int                `json:"updated"`
+	Unchanged int                `json:"unchanged"`
+	Invalid   int                `json:"invalid"`
+	Rows      []*ImportRowResult `json:"rows"`
+}
+
+// ImportRowResult . . .
+type ImportRowResult struct {
+	Line     int                  `json:"line"`
+	Handle   string               `json:"handle"`
+	Action   string               `json:"action"`
+	Changes  []*changefeed.Change `json:"changes,omitempty"`
+	Problems []string             `json:"problems,omitempty"`
+}
+
+type importItem struct {
+	row    *ImportRow
+	result *ImportRowResult
+	old    *Product
+}
+
+// ReadImportCSV reads products in the catalog CSV layout. The first record must be a header naming the
+// columns; only handle is required.
+func ReadImportCSV(r io.Reader) ([]*ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read CSV header: %s", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+	if !strslice.Contains(header, handleColumn) {
+		return nil, fmt.Errorf("CSV header must include a %s column", handleColumn)
+	}
+
+	rows := []*ImportRow{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		row := &ImportRow{Line: line, Product: &Product{Details: &details{IsActive: true}}, Columns: []string{}}
+		for i, value := range record {
+			if i >= len(header) || header[i] == "" {
+				continue
+			}
+			if err := setCSVValue(row.Product, header[i], value); err != nil {
+				row.Problems = append(row.Problems, err.Error())
+				continue
+			}
+			row.Columns = append(row.Columns, header[i])
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// ReadImportJSON reads a JSON array of products in the same shape GetProduct returns.
+func ReadImportJSON(r io.Reader) ([]*ImportRow, error) {
+	products := []*Product{}
+	if err := json.NewDecoder(r).Decode(&products); err != nil {
+		return nil, fmt.Errorf("could not read JSON: %s", err)
+	}
+
+	rows := []*ImportRow{}
+	for i, p := range products {
+		rows = append(rows, &ImportRow{Line: i + 1, Product: p})
+	}
+	return rows, nil
+}
+
+// Import validates every row and works out what it would change. Unless dryRun is set, and only when every
+// row is valid, the changes are then written in a single transaction.
+func Import(rows []*ImportRow, dryRun bool) (*ImportReport, error) {
+	report := &ImportReport{DryRun: dryRun, Rows: []*ImportRowResult{}}
+	items := []*importItem{}
+	seen := map[string]int{}
+
+	for _, row := range rows {
+		item := &importItem{row: row, result: &ImportRowResult{Line: row.Line, Problems: row.Problems}}
+		items = append(items, item)
+		report.Rows = append(report.Rows, item.result)
+
+		p := row.Product
+		if p.Details == nil {
+			p.Details = &details{}
+		}
+		item.result.Handle = p.Details.Handle
+
+		if line, ok := seen[p.Details.Handle]; ok && p.Details.Handle != "" {
+			item.result.Problems = append(item.result.Problems, fmt.Sprintf("handle %s is already used on line %d", p.Details.Handle, line))
+		}
+		seen[p.Details.Handle] = row.Line
+
+		old, err := getFromDb(p.Details.Handle, nil)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if err == nil {
+			item.old = old
+			mergeUnset(p, old, row.Columns)
+		}
+
+		if err := p.Validate(); err != nil {
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				return nil, err
+			}
+			item.result.Problems = append(item.result.Problems, validationErr.Problems...)
+		}
+
+		switch {
+		case len(item.result.Problems) > 0:
+			item.result.Action = importInvalid
+			report.Invalid++
+		case item.old == nil:
+			item.result.Action = importCreate
+			item.result.Changes = changedFields(nil, p)
+			report.Created++
+		default:
+			item.result.Changes = changedFields(item.old, p)
+			if len(item.result.Changes) == 0 {
+				item.result.Action = importUnchanged
+				report.Unchanged++
+			} else {
+				item.result.Action = importUpdate
+				report.Updated++
+			}
+		}
+	}
+
+	if dryRun || report.Invalid > 0 {
+		return report, nil
+	}
+
+	if err := applyImport(items); err != nil {
+		return nil, err
+	}
+	report.Applied = true
+	return report, nil
+}
+
+func applyImport(items []*importItem) error {
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	changed := []*Product{}
+	for _, item := range items {
+		p := item.row.Product
+		switch item.result.Action {
+		case importCreate:
+			err = insert(tx, p, PriceSourceImport)
+		case importUpdate:
+			err = update(tx, item.old, p, PriceSourceImport)
+			changed = append(changed, item.old)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("line %d (%s): %s", item.row.Line, p.Details.Handle, err)
+		}
+		changed = append(changed, p)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	invalidate(db, changed...)
+	return nil
+}
+
+// mergeUnset copies the fields a partial CSV row left out from the stored product, so only the columns
+// present in the file are changed.
+func mergeUnset(p, old *Product, columns []string) {
+	if p.Details.ModifiedTime == "" {
+		p.Details.ModifiedTime = old.Details.ModifiedTime
+	}
+	if columns == nil {
+		return
+	}
+
+	for _, column := range CSVColumns {
+		if strslice.Contains(columns, column) {
+			continue
+		}
+		switch column {
+		case skuColumn:
+			p.SKU = old.SKU
+		case productTypeIDColumn:
+			p.ProductTypeID = old.ProductTypeID
+		case upcColumn:
+			p.UPC = old.UPC
+		case titleColumn:
+			p.Details.Title = old.Details.Title
+		case titleTagColumn:
+			p.Details.TitleTag = old.Details.TitleTag
+		case descriptionColumn:
+			p.Details.Description = old.Details.Description
+		case descriptionShortColumn:
+			p.Details.DescriptionShort = old.Details.DescriptionShort
+		case bodyHTMLColumn:
+			p.Details.BodyHTML = old.Details.BodyHTML
+		case priceColumn:
+			p.Details.Price = old.Details.Price
+		case imageURLColumn:
+			p.Details.ImageURL = old.Details.ImageURL
+		case isActiveColumn:
+			p.Details.IsActive = old.Details.IsActive
+		}
+	}
+}
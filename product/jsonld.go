@@ -0,0 +1,161 @@
+package product
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/inventory"
+)
+
+const (
+	// Brand . . .
+	Brand = "weBoost"
+
+	productPath = "/products/"
+)
+
+// JSONLD is a schema.org Product.
+type JSONLD struct {
+	Context            string            `json:"@context"`
+	Type               string            `json:"@type"`
+	Name               string            `json:"name"`
+	Description        string            `json:"description,omitempty"`
+	SKU                string            `json:"sku"`
+	MPN                string            `json:"mpn"`
+	GTIN8              string            `json:"gtin8,omitempty"`
+	GTIN12             string            `json:"gtin12,omitempty"`
+	GTIN13             string            `json:"gtin13,omitempty"`
+	GTIN14             string            `json:"gtin14,omitempty"`
+	Image              []string          `json:"image,omitempty"`
+	URL                string            `json:"url"`
+	Category           string            `json:"category,omitempty"`
+	Brand              *jsonLDThing      `json:"brand"`
+	Offers             *jsonLDOffer      `json:"offers"`
+	AdditionalProperty []*jsonLDProperty `json:"additionalProperty,omitempty"`
+}
+
+type jsonLDThing struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+type jsonLDOffer struct {
+	Type          string `json:"@type"`
+	URL           string `json:"url"`
+	Price         string `json:"price"`
+	PriceCurrency string `json:"priceCurrency"`
+	Availability  string `json:"availability"`
+	ItemCondition string `json:"itemCondition"`
+}
+
+type jsonLDProperty struct {
+	Type  string `json:"@type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// PageURL is the address of a product's page on the website, built from the SITE_URL environment variable.
+func PageURL(handle string) string {
+	return strings.TrimRight(os.Getenv("SITE_URL"), "/") + productPath + handle
+}
+
+// ValidGTIN checks the length and check digit of a GTIN-8, UPC-A, EAN-13 or GTIN-14.
+func ValidGTIN(s string) bool {
+	if n := len(s); n != 8 && n != 12 && n != 13 && n != 14 {
+		return false
+	}
+	sum := 0
+	for i := range s {
+		digit, err := strconv.Atoi(s[i : i+1])
+		if err != nil {
+			return false
+		}
+		// Weights alternate 3,1,... from the rightmost digit before the check digit.
+		if (len(s)-1-i)%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
+
+// jsonLDAvailability maps inventory statuses to schema.org item availability.
+var jsonLDAvailability = map[string]string{
+	inventory.StatusInStock:      "https://schema.org/InStock",
+	inventory.StatusLowStock:     "https://schema.org/LimitedAvailability",
+	inventory.StatusBackorder:    "https://schema.org/BackOrder",
+	inventory.StatusDiscontinued: "https://schema.org/Discontinued",
+}
+
+// JSONLDOptions loads only the collections JSONLD is built from, in loc.
+func JSONLDOptions(loc string) *Options {
+	return &Options{
+		Include: map[string]bool{detailsCollection: true, mediaCollection: true, specificationsCollection: true},
+		Locale:  loc,
+	}
+}
+
+// JSONLD returns the product as schema.org structured data.
+func (p *Product) JSONLD() *JSONLD {
+	d := p.Details
+	if d == nil {
+		d = &details{}
+	}
+
+	ld := &JSONLD{
+		Context:     "https://schema.org",
+		Type:        "Product",
+		Name:        d.Title,
+		Description: d.DescriptionShort.StringOr(d.Description.StringOr("")),
+		SKU:         p.SKU,
+		MPN:         p.SKU,
+		URL:         PageURL(d.Handle),
+		Category:    p.ProductType,
+		Brand:       &jsonLDThing{Type: "Brand", Name: Brand},
+		Offers: &jsonLDOffer{
+			Type:          "Offer",
+			URL:           PageURL(d.Handle),
+			Price:         d.Price.Money().String(),
+			PriceCurrency: d.Price.Money().Currency(),
+			Availability:  "https://schema.org/Discontinued",
+			ItemCondition: "https://schema.org/NewCondition",
+		},
+	}
+	if d.IsActive && !d.IsDeleted {
+		ld.Offers.Availability = "https://schema.org/InStock"
+		if p.Availability != nil {
+			ld.Offers.Availability = jsonLDAvailability[p.Availability.Status]
+		}
+	}
+
+	if ValidGTIN(p.UPC) {
+		switch len(p.UPC) {
+		case 8:
+			ld.GTIN8 = p.UPC
+		case 12:
+			ld.GTIN12 = p.UPC
+		case 13:
+			ld.GTIN13 = p.UPC
+		case 14:
+			ld.GTIN14 = p.UPC
+		}
+	}
+
+	if d.ImageURL != "" {
+		ld.Image = append(ld.Image, d.ImageURL)
+	}
+	for _, m := range p.Medias {
+		if m.IsActive && m.MediaTypeID == MediaTypeImage && m.MediaLinkURL.Valid && m.MediaLinkURL.Chars != d.ImageURL {
+			ld.Image = append(ld.Image, m.MediaLinkURL.Chars)
+		}
+	}
+
+	for _, s := range p.Specifications {
+		if s.IsActive {
+			ld.AdditionalProperty = append(ld.AdditionalProperty, &jsonLDProperty{Type: "PropertyValue", Name: s.SpecificationLabel, Value: s.FieldValue})
+		}
+	}
+
+	return ld
+}
@@ -0,0 +1,197 @@
+package product
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/locale"
+	"github.com/wilsonelectronics/productsapi/rendition"
+	"github.com/wilsonelectronics/productsapi/strslice"
+)
+
+// Media types, by their mediaTypeId.
+const (
+	// MediaTypeImage is the main product images.
+	MediaTypeImage = 1
+	// MediaTypeGalleryImage . . .
+	MediaTypeGalleryImage = 2
+	// MediaTypeInstallationVideo . . .
+	MediaTypeInstallationVideo = 3
+	// MediaTypeUserManual . . .
+	MediaTypeUserManual = 4
+	// MediaTypeSpecSheet . . .
+	MediaTypeSpecSheet = 5
+	// MediaTypeFCCCertificate . . .
+	MediaTypeFCCCertificate = 6
+)
+
+// Kinds of media, which decide the metadata a media item can have: dimensions for images, a duration for
+// videos, and a file size and language for documents.
+const (
+	// MediaKindImage . . .
+	MediaKindImage = "image"
+	// MediaKindVideo . . .
+	MediaKindVideo = "video"
+	// MediaKindDocument . . .
+	MediaKindDocument = "document"
+)
+
+// MediaType . . .
+type MediaType struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Kind  string `json:"kind"`
+}
+
+// MediaTypes lists every media type in the order media groups are shown in.
+var MediaTypes = []*MediaType{
+	{ID: MediaTypeImage, Name: "image", Label: "Images", Kind: MediaKindImage},
+	{ID: MediaTypeGalleryImage, Name: "galleryImage", Label: "Gallery", Kind: MediaKindImage},
+	{ID: MediaTypeInstallationVideo, Name: "installationVideo", Label: "Installation Videos", Kind: MediaKindVideo},
+	{ID: MediaTypeUserManual, Name: "userManual", Label: "User Manuals", Kind: MediaKindDocument},
+	{ID: MediaTypeSpecSheet, Name: "specSheet", Label: "Spec Sheets", Kind: MediaKindDocument},
+	{ID: MediaTypeFCCCertificate, Name: "fccCertificate", Label: "FCC Certificates", Kind: MediaKindDocument},
+}
+
+// MediaGroup is the active media of one type, in media order.
+type MediaGroup struct {
+	Type  string   `json:"type"`
+	Label string   `json:"label"`
+	Kind  string   `json:"kind"`
+	Media []*media `json:"media"`
+}
+
+// Document is a downloadable document of a product.
+type Document struct {
+	Type        string `json:"type"`
+	Label       string `json:"label"`
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	FileSize    int64  `json:"fileSize,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Language    string `json:"language,omitempty"`
+}
+
+func mediaType(id int) *MediaType {
+	for _, t := range MediaTypes {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// GetDocuments returns the active documents of the product with handle, grouped by type in MediaTypes order.
+// A language keeps only the documents in that language and those whose language is not known.
+func GetDocuments(handle string, language string) ([]*Document, error) {
+	p, err := GetByHandleWithOptions(handle, &Options{Include: map[string]bool{mediaCollection: true}})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	documents := []*Document{}
+	for _, g := range groupMedia(p.Medias) {
+		if g.Kind != MediaKindDocument {
+			continue
+		}
+		for _, m := range g.Media {
+			if language != "" && m.Language.Valid && m.Language.Chars != language {
+				continue
+			}
+			documents = append(documents, &Document{
+				Type:        g.Type,
+				Label:       g.Label,
+				Title:       m.MediaTitle.StringOr(""),
+				URL:         m.MediaLinkURL.StringOr(""),
+				FileSize:    m.FileSize.Int64Or(0),
+				ContentType: m.ContentType.StringOr(""),
+				Language:    m.Language.StringOr(""),
+			})
+		}
+	}
+	return documents, nil
+}
+
+// groupMedia returns the active media by type, in MediaTypes order. Media of unknown types is left out.
+func groupMedia(medias []*media) []*MediaGroup {
+	groups := []*MediaGroup{}
+	for _, t := range MediaTypes {
+		g := &MediaGroup{Type: t.Name, Label: t.Label, Kind: t.Kind, Media: []*media{}}
+		for _, m := range medias {
+			if m.IsActive && m.MediaTypeID == t.ID {
+				g.Media = append(g.Media, m)
+			}
+		}
+		if len(g.Media) > 0 {
+			sort.SliceStable(g.Media, func(i, j int) bool { return g.Media[i].MediaOrder < g.Media[j].MediaOrder })
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// setImageSets adds the renditions of the main image, the image media and the variant images of p. They are
+// made for each response rather than cached with the product, so they follow the rendition settings.
+func setImageSets(p *Product) {
+	if p.Details != nil {
+		p.Details.ImageSet = rendition.For(p.Details.ImageURL)
+	}
+	for _, m := range p.Medias {
+		if t := mediaType(m.MediaTypeID); t != nil && t.Kind == MediaKindImage {
+			m.ImageSet = rendition.For(m.MediaLinkURL.StringOr(""))
+		}
+	}
+	for _, v := range p.Variants {
+		v.ImageSet = rendition.For(v.ImageURL)
+	}
+}
+
+// validateMedia returns the problems with the media of p, including metadata that does not apply to the kind
+// of its media type.
+func validateMedia(p *Product) []string {
+	problems := []string{}
+	for i, m := range p.Medias {
+		if !m.MediaLinkURL.Valid || !isURL(m.MediaLinkURL.Chars) {
+			problems = append(problems, fmt.Sprintf("media[%d].mediaLinkURL is not a valid URL", i))
+		}
+
+		t := mediaType(m.MediaTypeID)
+		if t == nil {
+			problems = append(problems, fmt.Sprintf("media[%d].mediaTypeId %d is not a known media type", i, m.MediaTypeID))
+			continue
+		}
+
+		if m.Width.Valid != m.Height.Valid {
+			problems = append(problems, fmt.Sprintf("media[%d] needs both width and height, or neither", i))
+		}
+		if (m.Width.Valid && m.Width.Int32 <= 0) || (m.Height.Valid && m.Height.Int32 <= 0) {
+			problems = append(problems, fmt.Sprintf("media[%d] width and height must be positive", i))
+		}
+		if m.DurationSeconds.Valid && m.DurationSeconds.Int32 <= 0 {
+			problems = append(problems, fmt.Sprintf("media[%d].durationSeconds must be positive", i))
+		}
+		if m.FileSize.Valid && m.FileSize.Int64 <= 0 {
+			problems = append(problems, fmt.Sprintf("media[%d].fileSize must be positive", i))
+		}
+		if m.Language.Valid && !strslice.Contains(locale.Supported, m.Language.Chars) {
+			problems = append(problems, fmt.Sprintf("media[%d].language must be one of %s", i, strings.Join(locale.Supported, ", ")))
+		}
+
+		if t.Kind != MediaKindImage && (m.Width.Valid || m.Height.Valid) {
+			problems = append(problems, fmt.Sprintf("media[%d] width and height only apply to images", i))
+		}
+		if t.Kind != MediaKindVideo && m.DurationSeconds.Valid {
+			problems = append(problems, fmt.Sprintf("media[%d].durationSeconds only applies to videos", i))
+		}
+		if t.Kind != MediaKindDocument && (m.FileSize.Valid || m.Language.Valid) {
+			problems = append(problems, fmt.Sprintf("media[%d] fileSize and language only apply to documents", i))
+		}
+	}
+	return problems
+}
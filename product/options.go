@@ -0,0 +1,285 @@
+package product
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/locale"
+	"github.com/wilsonelectronics/productsapi/money"
+	"github.com/wilsonelectronics/productsapi/pricelist"
+)
+
+const (
+	detailsCollection         = "details"
+	tagsCollection            = "tags"
+	kitsCollection            = "kits"
+	mediaCollection           = "media"
+	notesCollection           = "notes"
+	specificationsCollection  = "specifications"
+	vendorsCollection         = "vendors"
+	relatedProductsCollection = "relatedProducts"
+	optionGroupsCollection    = "optionGroups"
+	variantsCollection        = "variants"
+
+	mediaGroupsField = "mediaGroups"
+)
+
+var collections = []string{
+	detailsCollection,
+	tagsCollection,
+	kitsCollection,
+	mediaCollection,
+	notesCollection,
+	specificationsCollection,
+	vendorsCollection,
+	relatedProductsCollection,
+	optionGroupsCollection,
+	variantsCollection,
+}
+
+// Options selects which parts of a product are loaded and returned. A nil *Options means everything.
+type Options struct {
+	// Include holds the child collections to load, keyed by their JSON name.
+	Include map[string]bool
+	// Fields holds the JSON fields to return. Nested details fields are written as "details.title".
+	Fields []string
+	// Currency selects the price list the price is taken from. Empty means money.Base.
+	Currency string
+	// Locale selects the language of the text fields. Empty means locale.Default.
+	Locale string
+}
+
+// OptionsFromQuery reads the include and fields query parameters. include lists the child collections
+// to return (include=details,media) or, prefixed with "-", the ones to leave out (include=-notes).
+func OptionsFromQuery(query url.Values) (*Options, error) {
+	opts := &Options{}
+
+	if include := splitList(query.Get("include")); len(include) > 0 {
+		opts.Include = map[string]bool{}
+		exclude := strings.HasPrefix(include[0], "-")
+		for _, c := range collections {
+			opts.Include[c] = exclude
+		}
+		for _, c := range include {
+			if strings.HasPrefix(c, "-") != exclude {
+				return nil, fmt.Errorf("include cannot mix included and excluded collections")
+			}
+			c = strings.TrimPrefix(c, "-")
+			if _, ok := opts.Include[c]; !ok {
+				return nil, fmt.Errorf("unknown collection %q in include", c)
+			}
+			opts.Include[c] = !exclude
+		}
+	}
+
+	opts.Fields = splitList(query.Get("fields"))
+
+	list, err := pricelist.ForCurrency(query.Get("currency"))
+	if err != nil {
+		return nil, err
+	}
+	opts.Currency = list.Currency
+
+	return opts, nil
+}
+
+// Marshal encodes p as JSON keeping only the requested fields.
+func (o *Options) Marshal(p *Product) ([]byte, error) {
+	productJSON, err := json.Marshal(p)
+	if err != nil || o == nil || len(o.Fields) == 0 {
+		return productJSON, err
+	}
+
+	all := map[string]json.RawMessage{}
+	if err = json.Unmarshal(productJSON, &all); err != nil {
+		return nil, err
+	}
+
+	nested := map[string][]string{}
+	selected := map[string]json.RawMessage{}
+	for _, f := range o.Fields {
+		parts := strings.SplitN(f, ".", 2)
+		if _, ok := all[parts[0]]; !ok {
+			continue
+		}
+		if len(parts) == 1 {
+			selected[f] = all[f]
+			delete(nested, f)
+		} else if _, whole := selected[parts[0]]; !whole {
+			nested[parts[0]] = append(nested[parts[0]], parts[1])
+		}
+	}
+
+	for parent, children := range nested {
+		fields := map[string]json.RawMessage{}
+		if err = json.Unmarshal(all[parent], &fields); err != nil {
+			// Not an object (e.g. null), so there is nothing to select from.
+			selected[parent] = all[parent]
+			continue
+		}
+		subset := map[string]json.RawMessage{}
+		for _, c := range children {
+			if v, ok := fields[c]; ok {
+				subset[c] = v
+			}
+		}
+		if selected[parent], err = json.Marshal(subset); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(selected)
+}
+
+func (o *Options) includes(collection string) bool {
+	return o == nil || o.Include == nil || o.Include[collection]
+}
+
+// needs reports whether a child collection has to be loaded to answer with these options.
+func (o *Options) needs(collection string) bool {
+	if !o.includes(collection) {
+		return false
+	}
+	if o == nil || len(o.Fields) == 0 {
+		return true
+	}
+	for _, f := range o.Fields {
+		if f == collection || strings.HasPrefix(f, collection+".") {
+			return true
+		}
+		// mediaGroups is made from the media.
+		if collection == mediaCollection && (f == mediaGroupsField || strings.HasPrefix(f, mediaGroupsField+".")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Options) loadsAll() bool {
+	for _, c := range collections {
+		if !o.needs(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// prune drops the child collections that are not included.
+func (o *Options) prune(p *Product) {
+	if !o.includes(detailsCollection) {
+		p.Details = nil
+	}
+	if !o.includes(tagsCollection) {
+		p.Tags = nil
+	}
+	if !o.includes(kitsCollection) {
+		p.Kits = nil
+	}
+	if !o.includes(mediaCollection) {
+		p.Medias = nil
+		p.MediaGroups = nil
+	}
+	if !o.includes(notesCollection) {
+		p.Notes = nil
+	}
+	if !o.includes(specificationsCollection) {
+		p.Specifications = nil
+	}
+	if !o.includes(vendorsCollection) {
+		p.Vendors = nil
+	}
+	if !o.includes(relatedProductsCollection) {
+		p.RelatedProducts = nil
+	}
+	if !o.includes(optionGroupsCollection) {
+		p.OptionGroups = nil
+	}
+	if !o.includes(variantsCollection) {
+		p.Variants = nil
+	}
+}
+
+// price replaces the base prices of p and its variants with their prices in the selected price list.
+// Variants are converted at the product's rate, so p is priced while it still has its details.
+func (o *Options) price(p *Product) error {
+	if o == nil || o.Currency == "" || o.Currency == money.Base || p.Details == nil {
+		return nil
+	}
+
+	prices, err := pricelist.Get(o.Currency)
+	if err != nil {
+		return err
+	}
+	for _, v := range p.Variants {
+		v.Price = prices.VariantPrice(p.GUID, p.Details.Price, v.Price)
+	}
+	p.Details.Price = prices.Price(p.GUID, p.Details.Price)
+	return nil
+}
+
+// localize replaces the text fields of p with their translation into the selected locale, where there is one.
+func (o *Options) localize(p *Product) error {
+	if o == nil || o.Locale == "" || o.Locale == locale.Default {
+		return nil
+	}
+
+	t, err := locale.GetForProduct(o.Locale, p.GUID)
+	if err != nil {
+		return err
+	}
+
+	if p.Details != nil {
+		texts := t.Product(p.GUID)
+		if texts.Title.Valid {
+			p.Details.Title = texts.Title.Chars
+		}
+		if texts.Description.Valid {
+			p.Details.Description = texts.Description
+		}
+		if texts.DescriptionShort.Valid {
+			p.Details.DescriptionShort = texts.DescriptionShort
+		}
+		if texts.BodyHTML.Valid {
+			p.Details.BodyHTML = texts.BodyHTML
+		}
+	}
+	for _, n := range p.Notes {
+		text := t.Note(p.GUID, n.NoteOrder)
+		if text.NoteTitle.Valid {
+			n.NoteTitle = text.NoteTitle
+		}
+		if text.NoteText.Valid {
+			n.NoteText = text.NoteText
+		}
+	}
+	for _, s := range p.Specifications {
+		s.SpecificationLabel = t.SpecificationLabel(s.SpecificationID, s.SpecificationLabel)
+	}
+	return nil
+}
+
+// apply groups the media of p and adds its image renditions, vendor click-through links and availability,
+// then localizes p as the options ask.
+func (o *Options) apply(p *Product) error {
+	if p.Medias != nil {
+		p.MediaGroups = groupMedia(p.Medias)
+	}
+	setImageSets(p)
+	setClickURLs(p)
+	if err := setAvailability(p); err != nil {
+		return err
+	}
+	return o.localize(p)
+}
+
+func splitList(s string) []string {
+	list := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,266 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/wilsonelectronics/productsapi/data"
+	"github.com/wilsonelectronics/productsapi/money"
+)
+
+const (
+	// PriceSourceAPI marks prices written through the product endpoints.
+	PriceSourceAPI = "api"
+	// PriceSourceImport marks prices written by a catalog import.
+	PriceSourceImport = "import"
+	// PriceSourceSchedule marks prices applied from a scheduled price.
+	PriceSourceSchedule = "schedule"
+)
+
+// ErrScheduledPriceNotFound . . .
+var ErrScheduledPriceNotFound = errors.New("scheduled price not found or already applied")
+
+// PriceHistory . . .
+type PriceHistory struct {
+	Handle string `json:"handle"`
+	money.Price
+	Changes   []*PriceChange    `json:"changes"`
+	Scheduled []*ScheduledPrice `json:"scheduled"`
+}
+
+// PriceChange records one change of a product's price, newest first in a PriceHistory. OldPrice is in the
+// currency of the price, and is null for the price a product was created with.
+type PriceChange struct {
+	OldPrice money.Amount `json:"oldPrice"`
+	money.Price
+	Source      string `json:"source"`
+	ChangedTime string `json:"changedTime"`
+}
+
+// ScheduledPrice is a price that takes effect at EffectiveTime.
+type ScheduledPrice struct {
+	ID int64 `json:"id"`
+	money.Price
+	EffectiveTime string `json:"effectiveTime"`
+	CreatedTime   string `json:"createdTime"`
+}
+
+type duePrice struct {
+	id     int64
+	handle string
+	price  money.Money
+}
+
+// GetPriceHistory returns the current price of the product with handle, its past changes and the prices
+// scheduled for it that have not taken effect yet.
+func GetPriceHistory(handle string) (*PriceHistory, error) {
+	p, err := GetByHandleWithOptions(handle, &Options{Include: map[string]bool{detailsCollection: true}})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	history := &PriceHistory{Handle: handle, Price: p.Details.Price, Changes: []*PriceChange{}, Scheduled: []*ScheduledPrice{}}
+
+	rows, err := db.Query("set nocount on; exec [spcProductPriceHistoryGet] ?", p.GUID)
+	if err != nil {
+		return nil, fmt.Errorf("spcProductPriceHistoryGet Query failed: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := &PriceChange{}
+		var oldPrice money.Price
+		if err = rows.Scan(
+			&oldPrice,
+			&c.Price,
+			&c.Source,
+			&c.ChangedTime); err != nil {
+			return nil, fmt.Errorf("spcProductPriceHistoryGet Query Scan failed: %s", err)
+		}
+		c.OldPrice = oldPrice.Amount
+		history.Changes = append(history.Changes, c)
+	}
+
+	scheduledRows, err := db.Query("set nocount on; exec [spcProductScheduledPricesGet] ?", p.GUID)
+	if err != nil {
+		return nil, fmt.Errorf("spcProductScheduledPricesGet Query failed: %s", err)
+	}
+	defer scheduledRows.Close()
+
+	for scheduledRows.Next() {
+		s := &ScheduledPrice{}
+		if err = scheduledRows.Scan(
+			&s.ID,
+			&s.Price,
+			&s.EffectiveTime,
+			&s.CreatedTime); err != nil {
+			return nil, fmt.Errorf("spcProductScheduledPricesGet Query Scan failed: %s", err)
+		}
+		history.Scheduled = append(history.Scheduled, s)
+	}
+
+	return history, nil
+}
+
+// SchedulePrice sets the price of the product with handle to price at effectiveTime, which must be in the future.
+func SchedulePrice(handle string, price money.Money, effectiveTime time.Time) (*ScheduledPrice, error) {
+	problems := []string{}
+	if price.IsNegative() {
+		problems = append(problems, "price cannot be negative")
+	}
+	if price.Currency() != money.Base {
+		problems = append(problems, fmt.Sprintf("price must be in %s", money.Base))
+	}
+	if !effectiveTime.After(time.Now()) {
+		problems = append(problems, "effectiveTime must be in the future")
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	s := &ScheduledPrice{Price: money.PriceOf(price)}
+	err = db.QueryRow("set nocount on; exec [spcProductScheduledPriceInsert] ?, ?, ?", handle, price, effectiveTime.UTC()).Scan(
+		&s.ID,
+		&s.EffectiveTime,
+		&s.CreatedTime)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("spcProductScheduledPriceInsert failed: %s", err)
+	}
+
+	return s, nil
+}
+
+// CancelScheduledPrice removes a scheduled price that has not taken effect yet.
+func CancelScheduledPrice(id int64) error {
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("set nocount off; exec [spcProductScheduledPriceDelete] ?", id)
+	if err != nil {
+		return fmt.Errorf("spcProductScheduledPriceDelete failed: %s", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrScheduledPriceNotFound
+	}
+	return nil
+}
+
+// RunScheduledPrices applies due scheduled prices every interval until ctx is done.
+func RunScheduledPrices(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := ApplyScheduledPrices(); err != nil {
+			log.Printf("applying scheduled prices failed: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ApplyScheduledPrices writes every scheduled price whose effective time has passed, recording the change
+// and dropping the cached copies of the products like any other update. A price that cannot be applied is
+// logged and marked failed, so it leaves the due prices instead of holding up the ones after it.
+func ApplyScheduledPrices() error {
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("set nocount on; exec [spcProductScheduledPricesDueGet]")
+	if err != nil {
+		return fmt.Errorf("spcProductScheduledPricesDueGet Query failed: %s", err)
+	}
+
+	due := []*duePrice{}
+	for rows.Next() {
+		d := &duePrice{}
+		if err = rows.Scan(&d.id, &d.handle, &d.price); err != nil {
+			rows.Close()
+			return fmt.Errorf("spcProductScheduledPricesDueGet Query Scan failed: %s", err)
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+
+	for _, d := range due {
+		if err = applyScheduledPrice(db, d.id, d.handle, d.price); err != nil {
+			log.Printf("applying scheduled price %d to %s failed: %s", d.id, d.handle, err)
+			if _, err = db.Exec("set nocount on; exec [spcProductScheduledPriceFail] ?, ?", d.id, err.Error()); err != nil {
+				log.Printf("spcProductScheduledPriceFail failed for scheduled price %d: %s", d.id, err)
+			}
+		}
+	}
+	return nil
+}
+
+func applyScheduledPrice(db *sql.DB, id int64, handle string, price money.Money) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Scheduled prices apply whatever else has changed since the schedule was set, so the product is locked
+	// before it is read and the update is checked against the modified time read under the lock.
+	if _, err = lock(tx, handle, "", true); err != nil {
+		return err
+	}
+	old, err := getFromDb(handle, nil)
+	if err != nil {
+		return err
+	}
+
+	// Only details are written; the nil child collections are kept as they are.
+	d := *old.Details
+	d.Price = money.PriceOf(price)
+	p := &Product{SKU: old.SKU, ProductTypeID: old.ProductTypeID, UPC: old.UPC, Details: &d}
+
+	if err = update(tx, old, p, PriceSourceSchedule); err != nil {
+		return err
+	}
+	if err = execProc(tx, "spcProductScheduledPriceApply", id); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	invalidate(db, old, p)
+	return nil
+}
+
+// recordPriceChange adds a row to the price history of the product with guid. oldPrice is nil for a new product.
+func recordPriceChange(tx *sql.Tx, guid string, oldPrice interface{}, price money.Money, source string) error {
+	return execProc(tx, "spcProductPriceHistoryInsert", guid, oldPrice, price, source)
+}
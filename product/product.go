@@ -1,12 +1,19 @@
 package product
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/wilsonelectronics/productsapi/cache"
 	"github.com/wilsonelectronics/productsapi/data"
+	"github.com/wilsonelectronics/productsapi/inventory"
+	"github.com/wilsonelectronics/productsapi/money"
+	"github.com/wilsonelectronics/productsapi/rendition"
+	"github.com/wilsonelectronics/productsapi/spec"
 
 	"github.com/piotrkowalczuk/ntypes"
 )
@@ -22,10 +29,14 @@ type Product struct {
 	Tags            []*productTag           `json:"tags"`
 	Kits            []*kit                  `json:"kits"`
 	Medias          []*media                `json:"media"`
+	MediaGroups     []*MediaGroup           `json:"mediaGroups,omitempty"`
 	Notes           []*note                 `json:"notes"`
 	Specifications  []*productSpecification `json:"specifications"`
 	Vendors         []*productVendor        `json:"vendors"`
 	RelatedProducts []*relatedProduct       `json:"relatedProducts"`
+	OptionGroups    []*optionGroup          `json:"optionGroups"`
+	Variants        []*Variant              `json:"variants"`
+	Availability    *inventory.Availability `json:"availability,omitempty"`
 }
 
 type details struct {
@@ -34,12 +45,13 @@ type details struct {
 	Title            string        `json:"title"`
 	TitleTag         ntypes.String `json:"titleTag"`
 	BodyHTML         ntypes.String `json:"body_HTML"`
-	Price            float64       `json:"price"`
-	ImageURL         string        `json:"imageURL"`
-	Handle           string        `json:"handle"`
-	ModifiedTime     string        `json:"modifiedTime"`
-	IsActive         bool          `json:"isActive"`
-	IsDeleted        bool          `json:"isDeleted"`
+	money.Price
+	ImageURL     string         `json:"imageURL"`
+	ImageSet     *rendition.Set `json:"imageSet,omitempty"`
+	Handle       string         `json:"handle"`
+	ModifiedTime string         `json:"modifiedTime"`
+	IsActive     bool           `json:"isActive"`
+	IsDeleted    bool           `json:"isDeleted"`
 }
 
 type kit struct {
@@ -53,14 +65,22 @@ type kit struct {
 }
 
 type media struct {
-	GUID         string        `json:"guid"`
-	ProductGUID  string        `json:"productGuid"`
-	MediaTypeID  int           `json:"mediaTypeId"`
-	MediaTitle   ntypes.String `json:"mediaTitle"`
-	MediaLinkURL ntypes.String `json:"mediaLinkURL"`
-	MediaLogoURL ntypes.String `json:"mediaLogoURL"`
-	MediaOrder   int           `json:"mediaOrder"`
-	IsActive     bool          `json:"isActive"`
+	GUID            string         `json:"guid"`
+	ProductGUID     string         `json:"productGuid"`
+	MediaTypeID     int            `json:"mediaTypeId"`
+	MediaType       string         `json:"mediaType"`
+	MediaTitle      ntypes.String  `json:"mediaTitle"`
+	MediaLinkURL    ntypes.String  `json:"mediaLinkURL"`
+	MediaLogoURL    ntypes.String  `json:"mediaLogoURL"`
+	MediaOrder      int            `json:"mediaOrder"`
+	IsActive        bool           `json:"isActive"`
+	Width           ntypes.Int32   `json:"width"`
+	Height          ntypes.Int32   `json:"height"`
+	DurationSeconds ntypes.Int32   `json:"durationSeconds"`
+	FileSize        ntypes.Int64   `json:"fileSize"`
+	ContentType     ntypes.String  `json:"contentType"`
+	Language        ntypes.String  `json:"language"`
+	ImageSet        *rendition.Set `json:"imageSet,omitempty"`
 }
 
 type note struct {
@@ -74,14 +94,18 @@ type note struct {
 }
 
 type productSpecification struct {
-	GUID               string `json:"guid"`
-	ProductGUID        string `json:"productGuid"`
-	SpecificationID    int    `json:"specificationId"`
-	FieldValue         string `json:"specificationValue"`
-	IsActive           bool   `json:"isActive"`
-	SpecificationLabel string `json:"specificationLabel"`
+	GUID               string      `json:"guid"`
+	ProductGUID        string      `json:"productGuid"`
+	SpecificationID    int         `json:"specificationId"`
+	FieldValue         string      `json:"specificationValue"`
+	IsActive           bool        `json:"isActive"`
+	SpecificationLabel string      `json:"specificationLabel"`
+	Value              *spec.Value `json:"value,omitempty"`
+	Group              string      `json:"group,omitempty"`
 }
 
+// productVendor is a link to a product at a vendor. Its price is the vendor's own, in the vendor's currency;
+// price lists only apply to the product's price.
 type productVendor struct {
 	GUID             string `json:"guid"`
 	ProductGUID      string `json:"productGuid"`
@@ -89,14 +113,22 @@ type productVendor struct {
 	VendorName       string `json:"vendorName"`
 	VendorImageURL   string `json:"vendorImageURL"`
 	ProductVendorURL string `json:"productVendorURL"`
+	money.Price
+	StockStatus     string        `json:"stockStatus"`
+	LastCheckedTime ntypes.String `json:"lastCheckedTime"`
+	TrackingURL     string        `json:"trackingURL,omitempty"`
+	ClickURL        string        `json:"clickURL,omitempty"`
+	urlTemplate     string
 }
 
 type relatedProduct struct {
-	GUID        string `json:"guid"`
-	ProductGUID string `json:"productGuid"`
-	SKU         string `json:"sku"`
-	ImageURL    string `json:"imageURL"`
-	Handle      string `json:"handle"`
+	GUID             string `json:"guid"`
+	ProductGUID      string `json:"productGuid"`
+	SKU              string `json:"sku"`
+	ImageURL         string `json:"imageURL"`
+	Handle           string `json:"handle"`
+	RelationshipType string `json:"relationshipType"`
+	RelatedOrder     int    `json:"relatedOrder"`
 }
 
 type productTag struct {
@@ -107,6 +139,12 @@ type productTag struct {
 	IsActive    bool   `json:"isActive"`
 }
 
+var modifiedTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+}
+
 type chanResult struct {
 	Result interface{}
 	Error  error
@@ -131,23 +169,69 @@ func mergeChans(cs ...<-chan *chanResult) <-chan *chanResult {
 	return out
 }
 
+// ParseModifiedTime reads the ModifiedTime strings returned by the database, returning the zero time when the
+// value is empty or in an unknown layout.
+func ParseModifiedTime(s string) time.Time {
+	for _, layout := range modifiedTimeLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
 // GetByHandle . . .
 func GetByHandle(handle string) (*Product, error) {
+	return GetByHandleWithOptions(handle, nil)
+}
+
+// GetByHandleWithOptions returns the product with only the child collections opts includes. A product that
+// is not cached is loaded with just those child queries, and is only cached when it was loaded in full.
+func GetByHandleWithOptions(handle string, opts *Options) (*Product, error) {
 	bytes, err := cache.Retrieve(handle)
 	if err != nil {
 		return nil, err
 	}
 
+	product := &Product{}
 	if bytes == nil {
-		return getFromDbAndCache(handle)
+		if opts.loadsAll() {
+			product, err = getFromDbAndCache(handle)
+		} else {
+			product, err = getFromDb(handle, opts)
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else if err = json.Unmarshal(bytes, product); err != nil {
+		return nil, err
 	}
 
-	product := &Product{}
-	err = json.Unmarshal(bytes, product)
-	return product, err
+	// Variants are priced from the product's base price, which goes with the details, so the prices are
+	// converted before the details can be pruned.
+	if err = opts.price(product); err != nil {
+		return nil, err
+	}
+	opts.prune(product)
+	return product, opts.apply(product)
 }
 
 func getFromDbAndCache(handle string) (*Product, error) {
+	product, err := getFromDb(handle, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	productJSON, err := json.Marshal(product)
+	if err != nil {
+		return nil, err
+	}
+	cache.Store(handle, productJSON)
+
+	return product, nil
+}
+
+func getFromDb(handle string, opts *Options) (*Product, error) {
 	db, err := data.GetDB()
 	if err != nil {
 		return nil, err
@@ -173,26 +257,32 @@ func getFromDbAndCache(handle string) (*Product, error) {
 		&product.Details.ModifiedTime,
 		&product.Details.IsActive,
 		&product.Details.IsDeleted); err != nil {
-		return nil, fmt.Errorf("spcProductGet Query Scan failed: %s", err)
-	}
-
-	kitChan := make(chan *chanResult)
-	vendorChan := make(chan *chanResult)
-	relatedProductsChan := make(chan *chanResult)
-	specificationsChan := make(chan *chanResult)
-	mediasChan := make(chan *chanResult)
-	notesChan := make(chan *chanResult)
-	tagsChan := make(chan *chanResult)
-
-	go getKits(product.GUID, kitChan)
-	go getVendors(product.GUID, vendorChan)
-	go getRelatedProducts(product.GUID, relatedProductsChan)
-	go getSpecifications(product.GUID, specificationsChan)
-	go getMedias(product.GUID, mediasChan)
-	go getNotes(product.GUID, notesChan)
-	go getTags(product.GUID, tagsChan)
-
-	for ch := range mergeChans(kitChan, vendorChan, relatedProductsChan, specificationsChan, mediasChan, notesChan, tagsChan) {
+		return nil, fmt.Errorf("spcProductGet Query Scan failed: %w", err)
+	}
+
+	loaders := map[string]func(string, chan *chanResult){
+		kitsCollection:            getKits,
+		vendorsCollection:         getVendors,
+		relatedProductsCollection: getRelatedProducts,
+		specificationsCollection:  getSpecifications,
+		mediaCollection:           getMedias,
+		notesCollection:           getNotes,
+		tagsCollection:            getTags,
+		optionGroupsCollection:    getOptionGroups,
+		variantsCollection:        getVariants,
+	}
+
+	chans := []<-chan *chanResult{}
+	for name, load := range loaders {
+		if !opts.needs(name) {
+			continue
+		}
+		ch := make(chan *chanResult)
+		go load(product.GUID, ch)
+		chans = append(chans, ch)
+	}
+
+	for ch := range mergeChans(chans...) {
 		if ch.Error != nil {
 			return nil, ch.Error
 		}
@@ -211,14 +301,17 @@ func getFromDbAndCache(handle string) (*Product, error) {
 			product.Notes = append(product.Notes, n)
 		} else if t, ok := ch.Result.(*productTag); ok {
 			product.Tags = append(product.Tags, t)
+		} else if g, ok := ch.Result.(*optionGroup); ok {
+			product.OptionGroups = append(product.OptionGroups, g)
+		} else if v, ok := ch.Result.(*Variant); ok {
+			product.Variants = append(product.Variants, v)
 		}
 	}
 
-	productJSON, err := json.Marshal(product)
-	if err != nil {
+	if err = typeSpecifications(product); err != nil {
 		return nil, err
 	}
-	cache.Store(handle, productJSON)
+	trackVendors(product)
 
 	return product, nil
 }
@@ -276,6 +369,7 @@ func getVendors(id string, ch chan *chanResult) {
 
 	for rows.Next() {
 		r := &productVendor{}
+		var price, currency, stockStatus, urlTemplate sql.NullString
 
 		if err = rows.Scan(
 			&r.GUID,
@@ -284,9 +378,22 @@ func getVendors(id string, ch chan *chanResult) {
 			&r.VendorName,
 			&r.VendorImageURL,
 			&r.ProductVendorURL,
+			&price,
+			&currency,
+			&stockStatus,
+			&r.LastCheckedTime,
+			&urlTemplate,
 		); err != nil {
 			ch <- &chanResult{Error: fmt.Errorf("spcProductVendorGet Query Scan failed: %s", err)}
 		}
+		if price.Valid {
+			r.Price = money.Price{Currency: currency.String}
+			if err = r.Price.Scan(price.String); err != nil {
+				ch <- &chanResult{Error: fmt.Errorf("spcProductVendorGet Query Scan failed: %s", err)}
+			}
+		}
+		r.StockStatus = stockStatusOrUnknown(stockStatus.String)
+		r.urlTemplate = urlTemplate.String
 		ch <- &chanResult{Result: r}
 	}
 }
@@ -317,6 +424,8 @@ func getRelatedProducts(id string, ch chan *chanResult) {
 			&r.SKU,
 			&r.ImageURL,
 			&r.Handle,
+			&r.RelationshipType,
+			&r.RelatedOrder,
 		); err != nil {
 			ch <- &chanResult{Error: fmt.Errorf("spcProductRelatedGet Query Scan failed: %s", err)}
 		}
@@ -385,9 +494,18 @@ func getMedias(id string, ch chan *chanResult) {
 			&r.MediaLinkURL,
 			&r.MediaLogoURL,
 			&r.MediaOrder,
-			&r.IsActive); err != nil {
+			&r.IsActive,
+			&r.Width,
+			&r.Height,
+			&r.DurationSeconds,
+			&r.FileSize,
+			&r.ContentType,
+			&r.Language); err != nil {
 			ch <- &chanResult{Error: fmt.Errorf("getProductMedia Query Scan failed: %s", err)}
 		}
+		if t := mediaType(r.MediaTypeID); t != nil {
+			r.MediaType = t.Name
+		}
 		ch <- &chanResult{Result: r}
 	}
 }
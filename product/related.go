@@ -0,0 +1,235 @@
+package product
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/wilsonelectronics/productsapi/inventory"
+	"github.com/wilsonelectronics/productsapi/money"
+	"github.com/wilsonelectronics/productsapi/rendition"
+)
+
+// Relationship types. Each type has an inverse that the related product shows, so a relationship is stored
+// once and written from either side; FrequentlyBoughtTogether is its own inverse.
+const (
+	// RelationshipAccessory . . .
+	RelationshipAccessory = "accessory"
+	// RelationshipAccessoryFor . . .
+	RelationshipAccessoryFor = "accessoryFor"
+	// RelationshipReplacementPart . . .
+	RelationshipReplacementPart = "replacementPart"
+	// RelationshipReplacementPartFor . . .
+	RelationshipReplacementPartFor = "replacementPartFor"
+	// RelationshipUpgrade . . .
+	RelationshipUpgrade = "upgrade"
+	// RelationshipUpgradeFrom . . .
+	RelationshipUpgradeFrom = "upgradeFrom"
+	// RelationshipBundleComponent . . .
+	RelationshipBundleComponent = "bundleComponent"
+	// RelationshipBundle is the inverse of RelationshipBundleComponent: the bundles a product is part of.
+	RelationshipBundle = "bundle"
+	// RelationshipFrequentlyBoughtTogether . . .
+	RelationshipFrequentlyBoughtTogether = "frequentlyBoughtTogether"
+
+	// DefaultRelationship is used when a related product is written without a type.
+	DefaultRelationship = RelationshipFrequentlyBoughtTogether
+)
+
+// RelationshipType . . .
+type RelationshipType struct {
+	Name    string `json:"name"`
+	Label   string `json:"label"`
+	Inverse string `json:"inverse"`
+}
+
+// RelationshipTypes lists every relationship type in the order related products are grouped in.
+var RelationshipTypes = []*RelationshipType{
+	{Name: RelationshipAccessory, Label: "Accessories", Inverse: RelationshipAccessoryFor},
+	{Name: RelationshipReplacementPart, Label: "Replacement Parts", Inverse: RelationshipReplacementPartFor},
+	{Name: RelationshipUpgrade, Label: "Upgrades", Inverse: RelationshipUpgradeFrom},
+	{Name: RelationshipBundleComponent, Label: "In the Bundle", Inverse: RelationshipBundle},
+	{Name: RelationshipFrequentlyBoughtTogether, Label: "Frequently Bought Together", Inverse: RelationshipFrequentlyBoughtTogether},
+	{Name: RelationshipAccessoryFor, Label: "Works With", Inverse: RelationshipAccessory},
+	{Name: RelationshipReplacementPartFor, Label: "Replacement Part For", Inverse: RelationshipReplacementPart},
+	{Name: RelationshipUpgradeFrom, Label: "Upgrade From", Inverse: RelationshipUpgrade},
+	{Name: RelationshipBundle, Label: "Bundles Including This", Inverse: RelationshipBundleComponent},
+}
+
+// Related holds the related products of a product grouped by relationship type, in RelationshipTypes order.
+type Related struct {
+	Handle string          `json:"handle"`
+	Groups []*RelatedGroup `json:"groups"`
+}
+
+// RelatedGroup . . .
+type RelatedGroup struct {
+	Type     string         `json:"type"`
+	Label    string         `json:"label"`
+	Products []*RelatedItem `json:"products"`
+}
+
+// RelatedItem . . .
+type RelatedItem struct {
+	Handle string `json:"handle"`
+	SKU    string `json:"sku"`
+	Title  string `json:"title"`
+	money.Price
+	ImageURL     string                  `json:"imageURL"`
+	ImageSet     *rendition.Set          `json:"imageSet,omitempty"`
+	Availability *inventory.Availability `json:"availability,omitempty"`
+}
+
+func relationshipType(name string) *RelationshipType {
+	for _, t := range RelationshipTypes {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// GetRelated returns the active related products of the product with handle, grouped by type, with their
+// titles and prices localized and priced as opts ask.
+func GetRelated(handle string, opts *Options) (*Related, error) {
+	currency, loc := "", ""
+	if opts != nil {
+		currency, loc = opts.Currency, opts.Locale
+	}
+
+	p, err := GetByHandleWithOptions(handle, &Options{Include: map[string]bool{relatedProductsCollection: true}})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	relatedProducts := append([]*relatedProduct{}, p.RelatedProducts...)
+	sort.SliceStable(relatedProducts, func(i, j int) bool { return relatedProducts[i].RelatedOrder < relatedProducts[j].RelatedOrder })
+
+	items := make([]*RelatedItem, len(relatedProducts))
+	errs := make([]error, len(relatedProducts))
+	var wg sync.WaitGroup
+	wg.Add(len(relatedProducts))
+	for i, rp := range relatedProducts {
+		go func(i int, rp *relatedProduct) {
+			defer wg.Done()
+			related, err := GetByHandleWithOptions(rp.Handle, &Options{Include: map[string]bool{detailsCollection: true}, Currency: currency, Locale: loc})
+			if errors.Is(err, sql.ErrNoRows) {
+				return
+			} else if err != nil {
+				errs[i] = err
+				return
+			}
+			if d := related.Details; d.IsActive && !d.IsDeleted {
+				if related.Availability != nil {
+					related.Availability.Warehouses = nil
+				}
+				items[i] = &RelatedItem{Handle: d.Handle, SKU: related.SKU, Title: d.Title, Price: d.Price, ImageURL: d.ImageURL, ImageSet: d.ImageSet,
+					Availability: related.Availability}
+			}
+		}(i, rp)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("could not load related product %s: %s", relatedProducts[i].Handle, err)
+		}
+	}
+
+	related := &Related{Handle: handle, Groups: []*RelatedGroup{}}
+	for _, t := range RelationshipTypes {
+		group := &RelatedGroup{Type: t.Name, Label: t.Label, Products: []*RelatedItem{}}
+		for i, rp := range relatedProducts {
+			if rp.RelationshipType == t.Name && items[i] != nil {
+				group.Products = append(group.Products, items[i])
+			}
+		}
+		if len(group.Products) > 0 {
+			related.Groups = append(related.Groups, group)
+		}
+	}
+
+	return related, nil
+}
+
+// validateRelatedProducts returns the problems with the related products of p, setting the type of those
+// written without one to DefaultRelationship.
+func validateRelatedProducts(p *Product) []string {
+	problems := []string{}
+	seen := map[string]bool{}
+	for i, rp := range p.RelatedProducts {
+		if rp.RelationshipType == "" {
+			rp.RelationshipType = DefaultRelationship
+		}
+
+		if strings.TrimSpace(rp.Handle) == "" {
+			problems = append(problems, fmt.Sprintf("relatedProducts[%d].handle is required", i))
+		} else if p.Details != nil && rp.Handle == p.Details.Handle {
+			problems = append(problems, fmt.Sprintf("relatedProducts[%d] cannot be the product itself", i))
+		}
+		if relationshipType(rp.RelationshipType) == nil {
+			problems = append(problems, fmt.Sprintf("relatedProducts[%d].relationshipType %q is unknown", i, rp.RelationshipType))
+		}
+		if key := rp.Handle + ";" + rp.RelationshipType; seen[key] {
+			problems = append(problems, fmt.Sprintf("relatedProducts[%d] is listed twice as %s", i, rp.RelationshipType))
+		} else {
+			seen[key] = true
+		}
+	}
+	return problems
+}
+
+// saveRelatedProducts replaces the relationships of p in both directions: spcProductRelatedDelete drops those
+// the product is on either side of, and spcProductRelatedInsert stores each one with its inverse type, so
+// the related product lists p without being written itself. An inverse keeps its place in the related
+// product's list; a new one goes after the related product's own related items, as the position of rp in p
+// says nothing about where p belongs in its list.
+func saveRelatedProducts(tx *sql.Tx, p *Product) error {
+	inverseOrders, err := getInverseOrders(tx, p.GUID)
+	if err != nil {
+		return err
+	}
+	if err = execProc(tx, "spcProductRelatedDelete", p.GUID); err != nil {
+		return err
+	}
+	for i, rp := range p.RelatedProducts {
+		rp.RelatedOrder = i
+
+		inverseOrder, ok := inverseOrders[rp.Handle]
+		if !ok {
+			if err := tx.QueryRow("set nocount on; exec [spcProductRelatedNextOrderGet] ?", rp.Handle).Scan(&inverseOrder); err != nil {
+				return fmt.Errorf("spcProductRelatedNextOrderGet failed: %s", err)
+			}
+		}
+		if err := execProc(tx, "spcProductRelatedInsert", p.GUID, rp.Handle, rp.RelationshipType, relationshipType(rp.RelationshipType).Inverse, i, inverseOrder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getInverseOrders returns where the product with guid is in the related lists of the products it is related
+// to, by their handles.
+func getInverseOrders(tx *sql.Tx, guid string) (map[string]int, error) {
+	rows, err := tx.Query("set nocount on; exec [spcProductRelatedInverseOrdersGet] ?", guid)
+	if err != nil {
+		return nil, fmt.Errorf("spcProductRelatedInverseOrdersGet Query failed: %s", err)
+	}
+	defer rows.Close()
+
+	orders := map[string]int{}
+	for rows.Next() {
+		var handle string
+		var order int
+		if err = rows.Scan(&handle, &order); err != nil {
+			return nil, fmt.Errorf("spcProductRelatedInverseOrdersGet Query Scan failed: %s", err)
+		}
+		orders[handle] = order
+	}
+	return orders, rows.Err()
+}
@@ -0,0 +1,177 @@
+package product
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/wilsonelectronics/productsapi/spec"
+)
+
+// SpecificationReport lists the products whose specifications do not follow the template of their product
+// type. Checked counts the products that have a template to follow.
+type SpecificationReport struct {
+	Checked int                   `json:"checked"`
+	Issues  []*SpecificationIssue `json:"issues"`
+}
+
+// SpecificationIssue is how the specifications of one product differ from its template: required
+// specifications it lacks, specifications the template does not have, and values not of their type.
+type SpecificationIssue struct {
+	Handle        string   `json:"handle"`
+	SKU           string   `json:"sku"`
+	ProductTypeID int      `json:"productTypeId"`
+	Missing       []string `json:"missing"`
+	Extra         []string `json:"extra"`
+	Invalid       []string `json:"invalid"`
+}
+
+// GetSpecificationReport checks every product of the productTypeID product type, or of every product type
+// when it is 0, against its template.
+func GetSpecificationReport(productTypeID int) (*SpecificationReport, error) {
+	schema, err := spec.GetSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SpecificationReport{Issues: []*SpecificationIssue{}}
+	err = Walk(func(p *Product) error {
+		if (productTypeID != 0 && p.ProductTypeID != productTypeID) || p.ProductTypeID <= 0 {
+			return nil
+		}
+		definitions := schema.ForProductType(p.ProductTypeID)
+		if len(definitions) == 0 {
+			return nil
+		}
+		report.Checked++
+
+		issue := &SpecificationIssue{
+			SKU:           p.SKU,
+			ProductTypeID: p.ProductTypeID,
+			Missing:       missingSpecifications(p, definitions),
+			Extra:         []string{},
+			Invalid:       []string{},
+		}
+		if p.Details != nil {
+			issue.Handle = p.Details.Handle
+		}
+		for _, s := range p.Specifications {
+			if !s.IsActive {
+				continue
+			}
+			d := definitionOf(definitions, s.SpecificationID)
+			if d == nil {
+				issue.Extra = append(issue.Extra, s.SpecificationLabel)
+			} else if _, err := d.Parse(s.FieldValue); err != nil {
+				issue.Invalid = append(issue.Invalid, err.Error())
+			}
+		}
+
+		if len(issue.Missing) > 0 || len(issue.Extra) > 0 || len(issue.Invalid) > 0 {
+			report.Issues = append(report.Issues, issue)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// typeSpecifications sets the typed value and group of every specification of p from the template of its
+// product type, and puts them in the template's order. Specifications the template lacks go last.
+func typeSpecifications(p *Product) error {
+	if len(p.Specifications) == 0 {
+		return nil
+	}
+
+	schema, err := spec.GetSchema()
+	if err != nil {
+		return err
+	}
+
+	rank := map[int]int{}
+	for _, t := range schema.Templates(p.ProductTypeID) {
+		for _, g := range t.Groups {
+			for _, d := range g.Specifications {
+				rank[d.SpecificationID] = len(rank)
+			}
+		}
+	}
+	for _, s := range p.Specifications {
+		s.Value = schema.Type(p.ProductTypeID, s.SpecificationID, s.FieldValue)
+		if d := schema.Definition(p.ProductTypeID, s.SpecificationID); d != nil {
+			s.Group = d.Group
+		}
+	}
+	if p.ProductTypeID > 0 {
+		sort.SliceStable(p.Specifications, func(i, j int) bool {
+			a, aRanked := rank[p.Specifications[i].SpecificationID]
+			b, bRanked := rank[p.Specifications[j].SpecificationID]
+			if aRanked != bRanked {
+				return aRanked
+			}
+			return a < b
+		})
+	}
+	return nil
+}
+
+// validateSpecifications returns the problems with the specifications of p against the template of its
+// product type: required specifications it lacks and values not of their type. Specifications the template
+// does not define are free-form text. Nothing is checked when the specifications are not being written.
+func validateSpecifications(p *Product) ([]string, error) {
+	problems := []string{}
+	if p.Specifications == nil || p.ProductTypeID <= 0 {
+		return problems, nil
+	}
+
+	schema, err := spec.GetSchema()
+	if err != nil {
+		return nil, err
+	}
+	definitions := schema.ForProductType(p.ProductTypeID)
+	for i, s := range p.Specifications {
+		d := definitionOf(definitions, s.SpecificationID)
+		if d == nil || s.FieldValue == "" {
+			continue
+		}
+		if _, err := d.Parse(s.FieldValue); err != nil {
+			problems = append(problems, fmt.Sprintf("specifications[%d].specificationValue: %s", i, err))
+		}
+	}
+	for _, label := range missingSpecifications(p, definitions) {
+		problems = append(problems, fmt.Sprintf("specification %q is required for this product type", label))
+	}
+	return problems, nil
+}
+
+// missingSpecifications returns the labels of the required definitions p has no active value for.
+func missingSpecifications(p *Product, definitions []*spec.Definition) []string {
+	missing := []string{}
+	for _, d := range definitions {
+		if !d.Required {
+			continue
+		}
+		found := false
+		for _, s := range p.Specifications {
+			if s.SpecificationID == d.SpecificationID && s.IsActive && s.FieldValue != "" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, d.Label)
+		}
+	}
+	return missing
+}
+
+func definitionOf(definitions []*spec.Definition, specificationID int) *spec.Definition {
+	for _, d := range definitions {
+		if d.SpecificationID == specificationID {
+			return d
+		}
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package product
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/data"
+	"github.com/wilsonelectronics/productsapi/inventory"
+	"github.com/wilsonelectronics/productsapi/money"
+	"github.com/wilsonelectronics/productsapi/rendition"
+	"github.com/wilsonelectronics/productsapi/strslice"
+
+	"github.com/piotrkowalczuk/ntypes"
+)
+
+// optionGroup is one dimension variants differ in, such as "Kit" or "Region", with its values in display order.
+type optionGroup struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// Variant is one purchasable version of a product. Options holds its value for every option group.
+type Variant struct {
+	GUID        string        `json:"guid"`
+	ProductGUID string        `json:"productGuid"`
+	SKU         string        `json:"sku"`
+	UPC         ntypes.String `json:"upc"`
+	money.Price
+	ImageURL     string                  `json:"imageURL"`
+	ImageSet     *rendition.Set          `json:"imageSet,omitempty"`
+	Options      map[string]string       `json:"options"`
+	IsDefault    bool                    `json:"isDefault"`
+	IsActive     bool                    `json:"isActive"`
+	VariantOrder int                     `json:"variantOrder"`
+	Availability *inventory.Availability `json:"availability,omitempty"`
+}
+
+func getOptionGroups(id string, ch chan *chanResult) {
+	defer close(ch)
+
+	db, err := data.GetDB()
+	if err != nil {
+		ch <- &chanResult{Error: err}
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.Query("set nocount on; exec [spcProductOptionGroupsGet] ?", id)
+	if err != nil {
+		ch <- &chanResult{Error: fmt.Errorf("spcProductOptionGroupsGet Query failed: %s", err)}
+		return
+	}
+	defer rows.Close()
+
+	// Rows come one per value, ordered by group and then value.
+	groups := []*optionGroup{}
+	for rows.Next() {
+		var name, value string
+		if err = rows.Scan(&name, &value); err != nil {
+			ch <- &chanResult{Error: fmt.Errorf("spcProductOptionGroupsGet Query Scan failed: %s", err)}
+			return
+		}
+		if len(groups) == 0 || groups[len(groups)-1].Name != name {
+			groups = append(groups, &optionGroup{Name: name, Values: []string{}})
+		}
+		groups[len(groups)-1].Values = append(groups[len(groups)-1].Values, value)
+	}
+
+	for _, g := range groups {
+		ch <- &chanResult{Result: g}
+	}
+}
+
+func getVariants(id string, ch chan *chanResult) {
+	defer close(ch)
+
+	db, err := data.GetDB()
+	if err != nil {
+		ch <- &chanResult{Error: err}
+		return
+	}
+	defer db.Close()
+
+	variants, err := queryVariants(db, id)
+	if err != nil {
+		ch <- &chanResult{Error: err}
+		return
+	}
+
+	for _, v := range variants {
+		ch <- &chanResult{Result: v}
+	}
+}
+
+// GetActiveVariants returns the active variants of the products with productGUIDs, keyed by product GUID,
+// for listings that show the options of each product.
+func GetActiveVariants(productGUIDs []string) (map[string][]*Variant, error) {
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	variants, err := queryVariants(db, strings.Join(productGUIDs, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	active := map[string][]*Variant{}
+	for _, v := range variants {
+		if v.IsActive {
+			active[v.ProductGUID] = append(active[v.ProductGUID], v)
+		}
+	}
+	return active, nil
+}
+
+// queryVariants loads the variants of the products whose GUIDs are comma separated in productGUIDs, in order.
+func queryVariants(db *sql.DB, productGUIDs string) ([]*Variant, error) {
+	rows, err := db.Query("set nocount on; exec [spcProductVariantsGet] ?", productGUIDs)
+	if err != nil {
+		return nil, fmt.Errorf("spcProductVariantsGet Query failed: %s", err)
+	}
+	defer rows.Close()
+
+	variants := []*Variant{}
+	byGUID := map[string]*Variant{}
+	for rows.Next() {
+		v := &Variant{Options: map[string]string{}}
+		if err = rows.Scan(
+			&v.GUID,
+			&v.ProductGUID,
+			&v.SKU,
+			&v.UPC,
+			&v.Price,
+			&v.ImageURL,
+			&v.IsDefault,
+			&v.IsActive,
+			&v.VariantOrder); err != nil {
+			return nil, fmt.Errorf("spcProductVariantsGet Query Scan failed: %s", err)
+		}
+		variants = append(variants, v)
+		byGUID[v.GUID] = v
+	}
+
+	optionRows, err := db.Query("set nocount on; exec [spcProductVariantOptionsGet] ?", productGUIDs)
+	if err != nil {
+		return nil, fmt.Errorf("spcProductVariantOptionsGet Query failed: %s", err)
+	}
+	defer optionRows.Close()
+
+	for optionRows.Next() {
+		var variantGUID, group, value string
+		if err = optionRows.Scan(&variantGUID, &group, &value); err != nil {
+			return nil, fmt.Errorf("spcProductVariantOptionsGet Query Scan failed: %s", err)
+		}
+		if v, ok := byGUID[variantGUID]; ok {
+			v.Options[group] = value
+		}
+	}
+
+	return variants, nil
+}
+
+// validateVariants returns the problems with the option groups and variants of p.
+func validateVariants(p *Product) []string {
+	problems := []string{}
+	if (p.OptionGroups == nil) != (p.Variants == nil) {
+		return append(problems, "optionGroups and variants must be written together")
+	}
+
+	groups := map[string][]string{}
+	for i, g := range p.OptionGroups {
+		if strings.TrimSpace(g.Name) == "" {
+			problems = append(problems, fmt.Sprintf("optionGroups[%d].name is required", i))
+			continue
+		}
+		if _, ok := groups[g.Name]; ok {
+			problems = append(problems, fmt.Sprintf("optionGroups[%d].name %q is repeated", i, g.Name))
+		}
+		if len(g.Values) == 0 {
+			problems = append(problems, fmt.Sprintf("optionGroups[%d] needs at least one value", i))
+		}
+		seen := map[string]bool{}
+		for _, value := range g.Values {
+			if strings.TrimSpace(value) == "" || seen[value] {
+				problems = append(problems, fmt.Sprintf("optionGroups[%d] values must be unique and not empty", i))
+				break
+			}
+			seen[value] = true
+		}
+		groups[g.Name] = g.Values
+	}
+
+	skus := map[string]bool{}
+	combinations := map[string]bool{}
+	defaults := 0
+	for i, v := range p.Variants {
+		if strings.TrimSpace(v.SKU) == "" {
+			problems = append(problems, fmt.Sprintf("variants[%d].sku is required", i))
+		} else if skus[v.SKU] {
+			problems = append(problems, fmt.Sprintf("variants[%d].sku %q is repeated", i, v.SKU))
+		}
+		skus[v.SKU] = true
+
+		if !v.Price.IsSet() {
+			problems = append(problems, fmt.Sprintf("variants[%d].price is required", i))
+		} else if v.Price.Money().IsNegative() {
+			problems = append(problems, fmt.Sprintf("variants[%d].price cannot be negative", i))
+		}
+		if v.Price.Money().Currency() != money.Base {
+			problems = append(problems, fmt.Sprintf("variants[%d].price must be in %s", i, money.Base))
+		}
+		if v.ImageURL != "" && !isURL(v.ImageURL) {
+			problems = append(problems, fmt.Sprintf("variants[%d].imageURL is not a valid URL", i))
+		}
+
+		combination := []string{}
+		for _, g := range p.OptionGroups {
+			value, ok := v.Options[g.Name]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("variants[%d] has no value for option %q", i, g.Name))
+			} else if !strslice.Contains(g.Values, value) {
+				problems = append(problems, fmt.Sprintf("variants[%d] option %q has unknown value %q", i, g.Name, value))
+			}
+			combination = append(combination, g.Name+"="+value)
+		}
+		unknown := []string{}
+		for name := range v.Options {
+			if _, ok := groups[name]; !ok {
+				unknown = append(unknown, name)
+			}
+		}
+		for _, name := range sorted(unknown) {
+			problems = append(problems, fmt.Sprintf("variants[%d] has unknown option %q", i, name))
+		}
+		sort.Strings(combination)
+		if key := strings.Join(combination, ";"); combinations[key] {
+			problems = append(problems, fmt.Sprintf("variants[%d] repeats the options of another variant", i))
+		} else {
+			combinations[key] = true
+		}
+
+		if v.IsDefault {
+			defaults++
+			if !v.IsActive {
+				problems = append(problems, fmt.Sprintf("variants[%d] is the default so it must be active", i))
+			}
+		}
+	}
+	if len(p.Variants) > 0 && defaults != 1 {
+		problems = append(problems, "exactly one variant must be the default")
+	}
+
+	return problems
+}
+
+func saveVariants(tx *sql.Tx, p *Product) error {
+	if p.OptionGroups != nil {
+		if err := execProc(tx, "spcProductOptionGroupsDelete", p.GUID); err != nil {
+			return err
+		}
+		for i, g := range p.OptionGroups {
+			for j, value := range g.Values {
+				if err := execProc(tx, "spcProductOptionValueInsert", p.GUID, g.Name, i, value, j); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if p.Variants != nil {
+		if err := execProc(tx, "spcProductVariantsDelete", p.GUID); err != nil {
+			return err
+		}
+		for i, v := range p.Variants {
+			if err := tx.QueryRow("set nocount on; exec [spcProductVariantInsert] ?, ?, ?, ?, ?, ?, ?, ?",
+				p.GUID,
+				v.SKU,
+				v.UPC,
+				v.Price,
+				v.ImageURL,
+				v.IsDefault,
+				v.IsActive,
+				i).Scan(&v.GUID); err != nil {
+				return fmt.Errorf("spcProductVariantInsert failed: %s", err)
+			}
+			for group, value := range v.Options {
+				if err := execProc(tx, "spcProductVariantOptionInsert", v.GUID, group, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,375 @@
+package product
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wilsonelectronics/productsapi/cache"
+	"github.com/wilsonelectronics/productsapi/data"
+	"github.com/wilsonelectronics/productsapi/money"
+	"github.com/wilsonelectronics/productsapi/strslice"
+)
+
+// Stock statuses a vendor can report for a product.
+const (
+	// StockInStock . . .
+	StockInStock = "inStock"
+	// StockLimited . . .
+	StockLimited = "limitedStock"
+	// StockOutOfStock . . .
+	StockOutOfStock = "outOfStock"
+	// StockPreOrder . . .
+	StockPreOrder = "preOrder"
+	// StockUnknown is the status of vendors that have not been checked.
+	StockUnknown = "unknown"
+)
+
+// StockStatuses . . .
+var StockStatuses = []string{StockInStock, StockLimited, StockOutOfStock, StockPreOrder, StockUnknown}
+
+// ErrVendorNotFound . . .
+var ErrVendorNotFound = errors.New("vendor not found")
+
+// URL template placeholders. Values are query-escaped, so {url} can be passed to an affiliate network as a
+// parameter of its own link.
+var templatePlaceholders = []string{"{url}", "{sku}", "{handle}", "{vendor}", "{vendorId}"}
+
+// Vendor is a retailer products can be bought from. URLTemplate turns the product's link at the vendor
+// into the link shown to customers: either query parameters added to the link, such as
+// "tag=weboost-20&utm_source=weboost&utm_campaign={handle}", or a whole URL wrapping it, such as
+// "https://click.example.com/deeplink?id=123&murl={url}".
+type Vendor struct {
+	VendorID       int    `json:"vendorId"`
+	VendorName     string `json:"vendorName"`
+	VendorImageURL string `json:"vendorImageURL"`
+	URLTemplate    string `json:"urlTemplate"`
+}
+
+// VendorOffer is a vendor's price and stock of a product, as last checked. The price is in the currency the
+// vendor sells in, and is never converted to a price list's currency.
+type VendorOffer struct {
+	SKU      string `json:"sku"`
+	VendorID int    `json:"vendorId"`
+	money.Price
+	StockStatus string    `json:"stockStatus"`
+	CheckedTime time.Time `json:"checkedTime"`
+}
+
+// VendorClicks counts the click-throughs to one vendor from one product.
+type VendorClicks struct {
+	Handle     string `json:"handle"`
+	SKU        string `json:"sku"`
+	VendorID   int    `json:"vendorId"`
+	VendorName string `json:"vendorName"`
+	Clicks     int    `json:"clicks"`
+}
+
+// GetVendors . . .
+func GetVendors() ([]*Vendor, error) {
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("set nocount on; exec [spcVendorsGet]")
+	if err != nil {
+		return nil, fmt.Errorf("spcVendorsGet Query failed: %s", err)
+	}
+	defer rows.Close()
+
+	vendors := []*Vendor{}
+	for rows.Next() {
+		v := &Vendor{}
+		var template sql.NullString
+		if err = rows.Scan(&v.VendorID, &v.VendorName, &v.VendorImageURL, &template); err != nil {
+			return nil, fmt.Errorf("spcVendorsGet Query Scan failed: %s", err)
+		}
+		v.URLTemplate = template.String
+		vendors = append(vendors, v)
+	}
+	return vendors, rows.Err()
+}
+
+// SetVendorURLTemplate sets the URL template of a vendor. An empty template shows product links as they are.
+// Cached products pick the new template up as they expire.
+func SetVendorURLTemplate(vendorID int, template string) error {
+	template = strings.TrimSpace(template)
+	if !validURLTemplate(template) {
+		return &ValidationError{Problems: []string{"urlTemplate must be query parameters or an http(s) URL, using only the placeholders " + strings.Join(templatePlaceholders, ", ")}}
+	}
+
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("set nocount off; exec [spcVendorURLTemplateSet] ?, ?", vendorID, sql.NullString{String: template, Valid: template != ""})
+	if err != nil {
+		return fmt.Errorf("spcVendorURLTemplateSet failed: %s", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrVendorNotFound
+	}
+	return nil
+}
+
+// SetVendorOffers records the prices and stock the vendors of the offers' products were found to have.
+// Nothing is written when any offer is invalid or names a product the vendor does not sell. Prices are
+// stored in the currency they are given in. Only the cached copies of the products that changed are dropped.
+func SetVendorOffers(offers []*VendorOffer) error {
+	problems := []string{}
+	for i, o := range offers {
+		if strings.TrimSpace(o.SKU) == "" {
+			problems = append(problems, fmt.Sprintf("offers[%d].sku is required", i))
+		}
+		if o.VendorID <= 0 {
+			problems = append(problems, fmt.Sprintf("offers[%d].vendorId is required", i))
+		}
+		if o.Price.Money().IsNegative() {
+			problems = append(problems, fmt.Sprintf("offers[%d].price cannot be negative", i))
+		}
+		if !validStockStatus(o.StockStatus) {
+			problems = append(problems, fmt.Sprintf("offers[%d].stockStatus must be one of %s", i, strings.Join(StockStatuses, ", ")))
+		}
+		if o.CheckedTime.After(time.Now()) {
+			problems = append(problems, fmt.Sprintf("offers[%d].checkedTime cannot be in the future", i))
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	handles := []string{}
+	for i, o := range offers {
+		checkedTime := o.CheckedTime
+		if checkedTime.IsZero() {
+			checkedTime = time.Now()
+		}
+		price, currency := offerPrice(o.Price)
+
+		var handle string
+		err = tx.QueryRow("set nocount on; exec [spcProductVendorOfferSet] ?, ?, ?, ?, ?, ?",
+			o.SKU, o.VendorID, price, currency, stockStatusOrUnknown(o.StockStatus), checkedTime.UTC()).Scan(&handle)
+		if err == sql.ErrNoRows {
+			problems = append(problems, fmt.Sprintf("offers[%d]: vendor %d does not sell %s", i, o.VendorID, o.SKU))
+			continue
+		} else if err != nil {
+			return fmt.Errorf("spcProductVendorOfferSet failed: %s", err)
+		}
+		handles = append(handles, handle)
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	cache.Delete(handles...)
+	return nil
+}
+
+// RecordVendorClick records a click-through from the product with handle to one of its vendors, and returns
+// the vendor link to send the customer to. Inactive and deleted products are not found. Failing to record
+// the click does not stop the customer.
+func RecordVendorClick(handle string, vendorID int, referrer string) (string, error) {
+	p, err := GetByHandle(handle)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+	if p.Details == nil || !p.Details.IsActive || p.Details.IsDeleted {
+		return "", ErrNotFound
+	}
+
+	var vendor *productVendor
+	for _, v := range p.Vendors {
+		if v.VendorID == vendorID {
+			vendor = v
+		}
+	}
+	if vendor == nil {
+		return "", ErrVendorNotFound
+	}
+
+	if err = insertVendorClick(p.GUID, vendorID, referrer); err != nil {
+		log.Printf("recording click to vendor %d from %s failed: %s", vendorID, handle, err)
+	}
+	if vendor.TrackingURL != "" {
+		return vendor.TrackingURL, nil
+	}
+	return vendor.ProductVendorURL, nil
+}
+
+// GetVendorClicks counts the click-throughs per product and vendor from from until to.
+func GetVendorClicks(from time.Time, to time.Time) ([]*VendorClicks, error) {
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("set nocount on; exec [spcVendorClicksGet] ?, ?", from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("spcVendorClicksGet Query failed: %s", err)
+	}
+	defer rows.Close()
+
+	clicks := []*VendorClicks{}
+	for rows.Next() {
+		c := &VendorClicks{}
+		if err = rows.Scan(&c.Handle, &c.SKU, &c.VendorID, &c.VendorName, &c.Clicks); err != nil {
+			return nil, fmt.Errorf("spcVendorClicksGet Query Scan failed: %s", err)
+		}
+		clicks = append(clicks, c)
+	}
+	return clicks, rows.Err()
+}
+
+func insertVendorClick(productGUID string, vendorID int, referrer string) error {
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err = db.Exec("set nocount on; exec [spcVendorClickInsert] ?, ?, ?", productGUID, vendorID, sql.NullString{String: referrer, Valid: referrer != ""}); err != nil {
+		return fmt.Errorf("spcVendorClickInsert failed: %s", err)
+	}
+	return nil
+}
+
+// trackVendors fills in the tracking link of every vendor of p from its vendor's URL template.
+func trackVendors(p *Product) {
+	handle := ""
+	if p.Details != nil {
+		handle = p.Details.Handle
+	}
+	for _, v := range p.Vendors {
+		v.TrackingURL = applyURLTemplate(v.urlTemplate, v.ProductVendorURL, map[string]string{
+			"{sku}":      p.SKU,
+			"{handle}":   handle,
+			"{vendor}":   v.VendorName,
+			"{vendorId}": strconv.Itoa(v.VendorID),
+		})
+	}
+}
+
+// setClickURLs points the vendors of p at the click-through endpoint, which records the click before
+// redirecting to the tracking link.
+func setClickURLs(p *Product) {
+	if p.Details == nil || p.Details.Handle == "" {
+		return
+	}
+	for _, v := range p.Vendors {
+		v.ClickURL = fmt.Sprintf("%s/products/%s/buy?vendorId=%d", strings.TrimRight(os.Getenv("API_BASE_URL"), "/"), url.PathEscape(p.Details.Handle), v.VendorID)
+	}
+}
+
+// keepVendorOffers carries the offers of old over to the vendors of p written without one, so rewriting the
+// vendor links of a product does not lose the prices and stock last found.
+func keepVendorOffers(old *Product, p *Product) {
+	for _, v := range p.Vendors {
+		if v.LastCheckedTime.Valid {
+			continue
+		}
+		for _, o := range old.Vendors {
+			if o.VendorID == v.VendorID {
+				v.Price, v.StockStatus, v.LastCheckedTime = o.Price, o.StockStatus, o.LastCheckedTime
+			}
+		}
+	}
+}
+
+// applyURLTemplate returns link as template asks, with values and {url} put in for the placeholders. A link
+// the template cannot be applied to is returned as it is.
+func applyURLTemplate(template string, link string, values map[string]string) string {
+	if template == "" {
+		return link
+	}
+
+	pairs := []string{"{url}", url.QueryEscape(link)}
+	for placeholder, value := range values {
+		pairs = append(pairs, placeholder, url.QueryEscape(value))
+	}
+	filled := strings.NewReplacer(pairs...).Replace(template)
+	if isURL(filled) {
+		return filled
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	params, err := url.ParseQuery(filled)
+	if err != nil {
+		return link
+	}
+	query := u.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func validURLTemplate(template string) bool {
+	if template == "" {
+		return true
+	}
+	filled := template
+	for _, placeholder := range templatePlaceholders {
+		filled = strings.Replace(filled, placeholder, "x", -1)
+	}
+	if strings.ContainsAny(filled, "{}") {
+		return false
+	}
+	if strings.Contains(filled, "://") {
+		return isURL(filled)
+	}
+	_, err := url.ParseQuery(filled)
+	return err == nil
+}
+
+func validStockStatus(status string) bool {
+	return status == "" || strslice.Contains(StockStatuses, status)
+}
+
+func stockStatusOrUnknown(status string) string {
+	if status == "" {
+		return StockUnknown
+	}
+	return status
+}
+
+// offerPrice splits a price into the amount and currency columns, both NULL when the price is not known.
+func offerPrice(price money.Price) (interface{}, interface{}) {
+	if !price.IsSet() {
+		return nil, nil
+	}
+	m := price.Money()
+	return m, m.Currency()
+}
@@ -0,0 +1,470 @@
+package product
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/cache"
+	"github.com/wilsonelectronics/productsapi/changefeed"
+	"github.com/wilsonelectronics/productsapi/data"
+	"github.com/wilsonelectronics/productsapi/money"
+)
+
+var (
+	// ErrNotFound . . .
+	ErrNotFound = errors.New("product not found")
+	// ErrConflict is returned when a product changed after the ModifiedTime the caller last read.
+	ErrConflict = errors.New("product was modified since it was last read; reload it and try again")
+)
+
+var handlePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// ValidationError lists every problem found with a product.
+type ValidationError struct {
+	Problems []string `json:"problems"`
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid product: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate . . .
+func (p *Product) Validate() error {
+	problems := []string{}
+	if strings.TrimSpace(p.SKU) == "" {
+		problems = append(problems, "sku is required")
+	}
+	if p.ProductTypeID <= 0 {
+		problems = append(problems, "productTypeId is required")
+	}
+
+	if p.Details == nil {
+		problems = append(problems, "details are required")
+	} else {
+		if strings.TrimSpace(p.Details.Title) == "" {
+			problems = append(problems, "details.title is required")
+		}
+		if !handlePattern.MatchString(p.Details.Handle) {
+			problems = append(problems, "details.handle must be lowercase letters, numbers and dashes")
+		}
+		if !p.Details.Price.IsSet() {
+			problems = append(problems, "details.price is required")
+		} else if p.Details.Price.Money().IsNegative() {
+			problems = append(problems, "details.price cannot be negative")
+		}
+		if p.Details.Price.Money().Currency() != money.Base {
+			problems = append(problems, fmt.Sprintf("details.price must be in %s; set other currencies through their price list", money.Base))
+		}
+		if p.Details.ImageURL != "" && !isURL(p.Details.ImageURL) {
+			problems = append(problems, "details.imageURL is not a valid URL")
+		}
+	}
+
+	for i, k := range p.Kits {
+		if strings.TrimSpace(k.KitItemName) == "" {
+			problems = append(problems, fmt.Sprintf("kits[%d].kitItemName is required", i))
+		}
+	}
+	problems = append(problems, validateMedia(p)...)
+	for i, n := range p.Notes {
+		if n.NoteTypeID <= 0 {
+			problems = append(problems, fmt.Sprintf("notes[%d].noteTypeId is required", i))
+		}
+	}
+	for i, s := range p.Specifications {
+		if s.SpecificationID <= 0 {
+			problems = append(problems, fmt.Sprintf("specifications[%d].specificationId is required", i))
+		}
+		if strings.TrimSpace(s.FieldValue) == "" {
+			problems = append(problems, fmt.Sprintf("specifications[%d].specificationValue is required", i))
+		}
+	}
+	for i, v := range p.Vendors {
+		if v.VendorID <= 0 {
+			problems = append(problems, fmt.Sprintf("vendors[%d].vendorId is required", i))
+		}
+		if !isURL(v.ProductVendorURL) {
+			problems = append(problems, fmt.Sprintf("vendors[%d].productVendorURL is not a valid URL", i))
+		}
+		if v.Price.Money().IsNegative() {
+			problems = append(problems, fmt.Sprintf("vendors[%d].price cannot be negative", i))
+		}
+		if !validStockStatus(v.StockStatus) {
+			problems = append(problems, fmt.Sprintf("vendors[%d].stockStatus must be one of %s", i, strings.Join(StockStatuses, ", ")))
+		}
+	}
+	problems = append(problems, validateRelatedProducts(p)...)
+	for i, t := range p.Tags {
+		if t.TagID <= 0 {
+			problems = append(problems, fmt.Sprintf("tags[%d].tagID is required", i))
+		}
+	}
+	problems = append(problems, validateVariants(p)...)
+
+	specificationProblems, err := validateSpecifications(p)
+	if err != nil {
+		return err
+	}
+	problems = append(problems, specificationProblems...)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Create . . .
+func Create(p *Product) (*Product, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = insert(tx, p, PriceSourceAPI); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	invalidate(db, p)
+	return GetByHandle(p.Details.Handle)
+}
+
+// Update replaces the product stored under handle. Child collections left nil in p are kept as they are,
+// while empty ones are cleared. p.Details.ModifiedTime must match the stored value or ErrConflict is returned.
+func Update(handle string, p *Product) (*Product, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	old, err := getFromDb(handle, nil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = update(tx, old, p, PriceSourceAPI); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	invalidate(db, old, p)
+	return GetByHandle(p.Details.Handle)
+}
+
+// Delete soft-deletes the product stored under handle. modifiedTime must match the stored value or
+// ErrConflict is returned.
+func Delete(handle string, modifiedTime string) error {
+	old, err := getFromDb(handle, nil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = lock(tx, handle, modifiedTime, false); err != nil {
+		return err
+	}
+
+	if err = execProc(tx, "spcProductDelete", old.GUID); err != nil {
+		return err
+	}
+
+	if err = changefeed.Record(tx, &changefeed.Event{
+		Type:        changefeed.ProductDeleted,
+		ProductGUID: old.GUID,
+		Handle:      old.Details.Handle,
+		Changes:     []*changefeed.Change{{Field: "details.isDeleted", Old: false, New: true}}}); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	invalidate(db, old)
+	return nil
+}
+
+// insert writes p as a new product. source records where its price came from.
+func insert(tx *sql.Tx, p *Product, source string) error {
+	if err := tx.QueryRow("set nocount on; exec [spcProductInsert] ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?",
+		p.SKU,
+		p.ProductTypeID,
+		p.UPC,
+		p.Details.Description,
+		p.Details.DescriptionShort,
+		p.Details.Title,
+		p.Details.TitleTag,
+		p.Details.BodyHTML,
+		p.Details.Price.Money(),
+		p.Details.ImageURL,
+		p.Details.Handle,
+		p.Details.IsActive).Scan(&p.GUID); err != nil {
+		return fmt.Errorf("spcProductInsert failed: %s", err)
+	}
+
+	if err := saveChildren(tx, p); err != nil {
+		return err
+	}
+
+	if err := recordPriceChange(tx, p.GUID, nil, p.Details.Price.Money(), source); err != nil {
+		return err
+	}
+
+	return changefeed.Record(tx, &changefeed.Event{
+		Type:        changefeed.ProductCreated,
+		ProductGUID: p.GUID,
+		Handle:      p.Details.Handle,
+		Changes:     changedFields(nil, p)})
+}
+
+// update writes p over old, the stored product it replaces. source records where a new price came from.
+// p.Details.ModifiedTime must match the stored value, so an old read before another write is rejected.
+func update(tx *sql.Tx, old *Product, p *Product, source string) error {
+	guid, err := lock(tx, old.Details.Handle, p.Details.ModifiedTime, false)
+	if err != nil {
+		return err
+	}
+	p.GUID = guid
+
+	if err = execProc(tx, "spcProductUpdate",
+		p.GUID,
+		p.SKU,
+		p.ProductTypeID,
+		p.UPC,
+		p.Details.Description,
+		p.Details.DescriptionShort,
+		p.Details.Title,
+		p.Details.TitleTag,
+		p.Details.BodyHTML,
+		p.Details.Price.Money(),
+		p.Details.ImageURL,
+		p.Details.Handle,
+		p.Details.IsActive); err != nil {
+		return err
+	}
+
+	keepVendorOffers(old, p)
+	if err = saveChildren(tx, p); err != nil {
+		return err
+	}
+
+	if !old.Details.Price.Money().Equal(p.Details.Price.Money()) {
+		if err = recordPriceChange(tx, p.GUID, old.Details.Price.Money(), p.Details.Price.Money(), source); err != nil {
+			return err
+		}
+	}
+
+	changes := changedFields(old, p)
+	if len(changes) == 0 {
+		return nil
+	}
+	return changefeed.Record(tx, &changefeed.Event{
+		Type:        changefeed.ProductUpdated,
+		ProductGUID: p.GUID,
+		Handle:      p.Details.Handle,
+		Changes:     changes})
+}
+
+// lock takes an update lock on the product and, unless unconditional is set, checks it has not changed
+// since modifiedTime.
+func lock(tx *sql.Tx, handle string, modifiedTime string, unconditional bool) (string, error) {
+	var guid, current string
+	err := tx.QueryRow("set nocount on; exec [spcProductLockGet] ?", handle).Scan(&guid, &current)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", fmt.Errorf("spcProductLockGet failed: %s", err)
+	}
+
+	if !unconditional && modifiedTime != current {
+		return "", ErrConflict
+	}
+	return guid, nil
+}
+
+func saveChildren(tx *sql.Tx, p *Product) error {
+	if p.Kits != nil {
+		if err := execProc(tx, "spcProductKitsDelete", p.GUID); err != nil {
+			return err
+		}
+		for _, k := range p.Kits {
+			if err := execProc(tx, "spcProductKitInsert", p.GUID, k.KitItemName, k.KitItemLinkURL, k.KitItemIconURL, k.ItemOrder, k.SKU); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.Medias != nil {
+		if err := execProc(tx, "spcProductMediaDelete", p.GUID); err != nil {
+			return err
+		}
+		for _, m := range p.Medias {
+			if err := execProc(tx, "spcProductMediaInsert",
+				p.GUID,
+				m.MediaTypeID,
+				m.MediaTitle,
+				m.MediaLinkURL,
+				m.MediaLogoURL,
+				m.MediaOrder,
+				m.IsActive,
+				m.Width,
+				m.Height,
+				m.DurationSeconds,
+				m.FileSize,
+				m.ContentType,
+				m.Language); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.Notes != nil {
+		if err := execProc(tx, "spcProductNotesDelete", p.GUID); err != nil {
+			return err
+		}
+		for _, n := range p.Notes {
+			if err := execProc(tx, "spcProductNoteInsert", p.GUID, n.NoteTypeID, n.NoteText, n.NoteOrder, n.NoteTitle, n.NoteIconImageURL); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.Specifications != nil {
+		if err := execProc(tx, "spcProductSpecificationsDelete", p.GUID); err != nil {
+			return err
+		}
+		for _, s := range p.Specifications {
+			if err := execProc(tx, "spcProductSpecificationInsert", p.GUID, s.SpecificationID, s.FieldValue, s.IsActive); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.Vendors != nil {
+		if err := execProc(tx, "spcProductVendorsDelete", p.GUID); err != nil {
+			return err
+		}
+		for _, v := range p.Vendors {
+			price, currency := offerPrice(v.Price)
+			if err := execProc(tx, "spcProductVendorInsert", p.GUID, v.VendorID, v.ProductVendorURL, price, currency, stockStatusOrUnknown(v.StockStatus), v.LastCheckedTime); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.RelatedProducts != nil {
+		if err := saveRelatedProducts(tx, p); err != nil {
+			return err
+		}
+	}
+
+	if p.Tags != nil {
+		if err := execProc(tx, "spcProductTagsDelete", p.GUID); err != nil {
+			return err
+		}
+		for _, t := range p.Tags {
+			if err := execProc(tx, "spcProductTagInsert", p.GUID, t.TagID, t.IsActive); err != nil {
+				return err
+			}
+		}
+	}
+
+	return saveVariants(tx, p)
+}
+
+func execProc(tx *sql.Tx, name string, args ...interface{}) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	if _, err := tx.Exec(fmt.Sprintf("set nocount on; exec [%s] %s", name, placeholders), args...); err != nil {
+		return fmt.Errorf("%s failed: %s", name, err)
+	}
+	return nil
+}
+
+// invalidate drops the cached copies of the products and of every list containing them: their categories and
+// tags, and the lists built from the whole catalog. Failures are ignored since the cached values expire on
+// their own.
+func invalidate(db *sql.DB, products ...*Product) {
+	keys := []string{cache.ActiveProductsKey, cache.MerchantFeedKey, cache.SitemapKey}
+	for _, p := range products {
+		if p.Details != nil {
+			keys = append(keys, p.Details.Handle)
+		}
+		// Relationships show on both sides, so the related products changed too.
+		for _, rp := range p.RelatedProducts {
+			keys = append(keys, rp.Handle)
+		}
+		for _, t := range p.Tags {
+			keys = append(keys, strconv.Itoa(t.TagID))
+		}
+		if p.GUID == "" {
+			continue
+		}
+
+		rows, err := db.Query("set nocount on; exec [spcProductCategoriesGet] ?", p.GUID)
+		if err != nil {
+			continue
+		}
+		for rows.Next() {
+			var categoryGUID string
+			if rows.Scan(&categoryGUID) == nil {
+				keys = append(keys, categoryGUID)
+			}
+		}
+		rows.Close()
+	}
+
+	cache.Delete(keys...)
+}
+
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
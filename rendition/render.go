@@ -0,0 +1,246 @@
+package rendition
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	// Registers the GIF decoder, so GIF sources can be rendered too.
+	_ "image/gif"
+
+	"github.com/wilsonelectronics/productsapi/cache"
+)
+
+const (
+	// renditionTTL is how long a rendition is cached. Renditions are expensive to make and only change when
+	// the source image is replaced at the same URL.
+	renditionTTL = 24 * time.Hour
+
+	maxSourceBytes     = 25 << 20
+	maxSourcePixels    = 40000000
+	maxSourceDimension = 10000
+	jpegQuality        = 85
+	webPQuality        = 80
+
+	// maxRenders bounds how many renditions are made at once, as each holds its decoded source in memory.
+	maxRenders = 4
+)
+
+var (
+	// ErrInvalidRendition is returned for widths not in Sizes and unknown formats.
+	ErrInvalidRendition = errors.New("invalid rendition")
+	// ErrSourceUnavailable is returned when the source image cannot be fetched or decoded.
+	ErrSourceUnavailable = errors.New("source image unavailable")
+)
+
+var client = &http.Client{Timeout: 15 * time.Second}
+
+var (
+	renders = make(chan struct{}, maxRenders)
+
+	flightsMu sync.Mutex
+	flights   = map[string]*flight{}
+)
+
+// flight is a rendition being made. Requests for the same rendition wait for it rather than making their own.
+type flight struct {
+	done chan struct{}
+	img  *Image
+	err  error
+}
+
+// Image is a rendered image and its content type.
+type Image struct {
+	Bytes       []byte
+	ContentType string
+}
+
+// Render returns the rendition of the image at source at width, in format, from the cache or by fetching
+// and converting the source. Sources narrower than width are not enlarged.
+func Render(source string, width int, format string) (*Image, error) {
+	if !validWidth(width) {
+		return nil, fmt.Errorf("%w: width must be one of the rendition sizes", ErrInvalidRendition)
+	}
+	switch format {
+	case FormatOriginal, FormatJPEG, FormatPNG:
+	case FormatWebP:
+		if !WebPSupported() {
+			return nil, fmt.Errorf("%w: webp is not supported", ErrInvalidRendition)
+		}
+	default:
+		return nil, fmt.Errorf("%w: format must be jpeg, png or webp", ErrInvalidRendition)
+	}
+
+	key := cacheKey(source, width, format)
+	b, err := cache.Retrieve(key)
+	if err != nil {
+		return nil, err
+	}
+	if b != nil {
+		return &Image{Bytes: b, ContentType: http.DetectContentType(b)}, nil
+	}
+
+	flightsMu.Lock()
+	f, ok := flights[key]
+	if !ok {
+		f = &flight{done: make(chan struct{})}
+		flights[key] = f
+	}
+	flightsMu.Unlock()
+
+	if ok {
+		<-f.done
+		return f.img, f.err
+	}
+
+	f.img, f.err = render(key, source, width, format)
+	close(f.done)
+
+	flightsMu.Lock()
+	delete(flights, key)
+	flightsMu.Unlock()
+
+	return f.img, f.err
+}
+
+// render makes the rendition and caches it under key, once one of the maxRenders slots is free.
+func render(key string, source string, width int, format string) (*Image, error) {
+	renders <- struct{}{}
+	defer func() { <-renders }()
+
+	src, sourceFormat, err := fetch(source)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatOriginal {
+		format = FormatJPEG
+		if sourceFormat != "jpeg" {
+			format = FormatPNG
+		}
+	}
+
+	b, err := encode(resize(src, width), format)
+	if err != nil {
+		return nil, err
+	}
+	cache.StoreFor(key, b, renditionTTL)
+
+	return &Image{Bytes: b, ContentType: http.DetectContentType(b)}, nil
+}
+
+func fetch(source string) (image.Image, string, error) {
+	if !isSourceURL(source) {
+		return nil, "", fmt.Errorf("%w: %s is not an http(s) URL", ErrSourceUnavailable, source)
+	}
+
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrSourceUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%w: %s answered %s", ErrSourceUnavailable, source, resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSourceBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrSourceUnavailable, err)
+	}
+	if len(b) > maxSourceBytes {
+		return nil, "", fmt.Errorf("%w: %s is larger than %d bytes", ErrSourceUnavailable, source, maxSourceBytes)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrSourceUnavailable, err)
+	}
+	if config.Width > maxSourceDimension || config.Height > maxSourceDimension {
+		return nil, "", fmt.Errorf("%w: %s is wider or taller than %d pixels", ErrSourceUnavailable, source, maxSourceDimension)
+	}
+	if config.Width*config.Height > maxSourcePixels {
+		return nil, "", fmt.Errorf("%w: %s is larger than %d pixels", ErrSourceUnavailable, source, maxSourcePixels)
+	}
+
+	img, sourceFormat, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrSourceUnavailable, err)
+	}
+	return img, sourceFormat, nil
+}
+
+func encode(img *image.RGBA, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatJPEG:
+		// JPEG has no transparency, so transparent pixels are shown on white.
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+	case FormatPNG:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+	case FormatWebP:
+		return encodeWebP(img)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeWebP converts img with cwebp, as the standard library has no WebP encoder.
+func encodeWebP(img *image.RGBA) ([]byte, error) {
+	dir, err := ioutil.TempDir("", "rendition")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := dir+"/in.png", dir+"/out.webp"
+	f, err := os.Create(in)
+	if err != nil {
+		return nil, err
+	}
+	if err = png.Encode(f, img); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+
+	if output, err := exec.Command(webPEncoder, "-quiet", "-q", strconv.Itoa(webPQuality), in, "-o", out).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("cwebp failed: %s: %s", err, bytes.TrimSpace(output))
+	}
+	return ioutil.ReadFile(out)
+}
+
+func validWidth(width int) bool {
+	for _, s := range Sizes {
+		if s.Width == width {
+			return true
+		}
+	}
+	return false
+}
+
+func cacheKey(source string, width int, format string) string {
+	sum := sha256.Sum256([]byte(source + "\n" + strconv.Itoa(width) + "\n" + format))
+	return "rendition:" + hex.EncodeToString(sum[:])
+}
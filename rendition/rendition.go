@@ -0,0 +1,141 @@
+package rendition
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Path is where the application serves renditions, relative to IMAGE_BASE_URL.
+const Path = "/images"
+
+// Output formats. FormatOriginal keeps JPEG sources as JPEG and converts everything else to PNG.
+const (
+	// FormatOriginal . . .
+	FormatOriginal = ""
+	// FormatJPEG . . .
+	FormatJPEG = "jpeg"
+	// FormatPNG . . .
+	FormatPNG = "png"
+	// FormatWebP . . .
+	FormatWebP = "webp"
+)
+
+// Size is a named rendition width. Only these widths are rendered, so a source has a bounded number of
+// renditions to generate and cache.
+type Size struct {
+	Name  string `json:"name"`
+	Width int    `json:"width"`
+}
+
+// Sizes lists the rendition widths from narrowest to widest.
+var Sizes = []*Size{
+	{Name: "thumbnail", Width: 160},
+	{Name: "small", Width: 320},
+	{Name: "medium", Width: 640},
+	{Name: "large", Width: 1024},
+	{Name: "xlarge", Width: 1600},
+}
+
+// Set is the renditions of one source image, ready for the src and srcset attributes of an img element.
+// WebPSrcset is left out when the server cannot encode WebP.
+type Set struct {
+	Src        string `json:"src"`
+	Thumbnail  string `json:"thumbnail"`
+	Srcset     string `json:"srcset"`
+	WebPSrcset string `json:"webpSrcset,omitempty"`
+}
+
+var (
+	webPOnce    sync.Once
+	webPEncoder string
+)
+
+// For returns the renditions of the image at source, or nil when there are none: source is not an absolute
+// http(s) URL or IMAGE_SIGNING_KEY is not set, so rendition URLs cannot be signed.
+func For(source string) *Set {
+	if signingKey() == "" || !isSourceURL(source) {
+		return nil
+	}
+
+	srcset := make([]string, len(Sizes))
+	webPSrcset := make([]string, len(Sizes))
+	for i, s := range Sizes {
+		srcset[i] = fmt.Sprintf("%s %dw", URL(source, s.Width, FormatOriginal), s.Width)
+		webPSrcset[i] = fmt.Sprintf("%s %dw", URL(source, s.Width, FormatWebP), s.Width)
+	}
+
+	set := &Set{
+		Src:       URL(source, size("medium").Width, FormatOriginal),
+		Thumbnail: URL(source, size("thumbnail").Width, FormatOriginal),
+		Srcset:    strings.Join(srcset, ", "),
+	}
+	if WebPSupported() {
+		set.WebPSrcset = strings.Join(webPSrcset, ", ")
+	}
+	return set
+}
+
+// URL returns the signed URL of the rendition of source at width in format.
+func URL(source string, width int, format string) string {
+	query := url.Values{}
+	query.Set("src", source)
+	query.Set("w", strconv.Itoa(width))
+	if format != FormatOriginal {
+		query.Set("fm", format)
+	}
+	query.Set("s", sign(source, width, format))
+	return strings.TrimRight(os.Getenv("IMAGE_BASE_URL"), "/") + Path + "?" + query.Encode()
+}
+
+// Verify reports whether signature is the one URL gave the rendition, so only renditions of catalog images
+// are generated.
+func Verify(source string, width int, format string, signature string) bool {
+	if signingKey() == "" {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(sign(source, width, format)))
+}
+
+// WebPSupported reports whether the cwebp encoder, at CWEBP_PATH or on the PATH, is available.
+func WebPSupported() bool {
+	webPOnce.Do(func() {
+		name := os.Getenv("CWEBP_PATH")
+		if name == "" {
+			name = "cwebp"
+		}
+		webPEncoder, _ = exec.LookPath(name)
+	})
+	return webPEncoder != ""
+}
+
+func sign(source string, width int, format string) string {
+	mac := hmac.New(sha256.New, []byte(signingKey()))
+	mac.Write([]byte(source + "\n" + strconv.Itoa(width) + "\n" + format))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func signingKey() string {
+	return os.Getenv("IMAGE_SIGNING_KEY")
+}
+
+func size(name string) *Size {
+	for _, s := range Sizes {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func isSourceURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,83 @@
+package rendition
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+type weight struct {
+	index  int
+	weight float64
+}
+
+// resize scales src down to width pixels wide, keeping its aspect ratio, by averaging the source pixels
+// each destination pixel covers. Sources no wider than width are only converted to RGBA.
+func resize(src image.Image, width int) *image.RGBA {
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	sw, sh := b.Dx(), b.Dy()
+	if width >= sw || sw == 0 {
+		return rgba
+	}
+	height := int(math.Round(float64(sh) * float64(width) / float64(sw)))
+	if height < 1 {
+		height = 1
+	}
+
+	// Scale each destination row from the source rows it covers, narrowing one source row at a time so
+	// only a row's worth of intermediate values is held, however tall the source is.
+	columns := weights(sw, width)
+	row := make([]float64, width*4)
+	acc := make([]float64, width*4)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, ws := range weights(sh, height) {
+		for i := range acc {
+			acc[i] = 0
+		}
+		for _, w := range ws {
+			narrow(rgba.Pix[w.index*rgba.Stride:], columns, row)
+			for i, v := range row {
+				acc[i] += v * w.weight
+			}
+		}
+		for i, v := range acc {
+			dst.Pix[y*dst.Stride+i] = uint8(math.Min(math.Round(v), 255))
+		}
+	}
+	return dst
+}
+
+// narrow scales the source row pix down to len(columns) pixels into row.
+func narrow(pix []uint8, columns [][]weight, row []float64) {
+	for x, ws := range columns {
+		acc := row[x*4 : x*4+4]
+		for c := range acc {
+			acc[c] = 0
+		}
+		for _, w := range ws {
+			for c := 0; c < 4; c++ {
+				acc[c] += float64(pix[w.index*4+c]) * w.weight
+			}
+		}
+	}
+}
+
+// weights returns, for each of n destination pixels, the source pixels out of m it covers and how much of
+// it each one makes up.
+func weights(m int, n int) [][]weight {
+	scale := float64(m) / float64(n)
+	all := make([][]weight, n)
+	for i := range all {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for j := int(start); j < m && float64(j) < end; j++ {
+			overlap := math.Min(end, float64(j+1)) - math.Max(start, float64(j))
+			if overlap > 0 {
+				all[i] = append(all[i], weight{index: j, weight: overlap / scale})
+			}
+		}
+	}
+	return all
+}
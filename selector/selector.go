@@ -0,0 +1,213 @@
+package selector
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/locale"
+	"github.com/wilsonelectronics/productsapi/money"
+	"github.com/wilsonelectronics/productsapi/pricelist"
+	"github.com/wilsonelectronics/productsapi/product"
+)
+
+// ErrInvalidAnswer is returned when an answer is not one its question accepts.
+var ErrInvalidAnswer = errors.New("invalid answer")
+
+var numberPattern = regexp.MustCompile(`\d[\d,]*(?:\.\d+)?`)
+
+// Result is where the selector stands after the answers given: the answers followed so far, the next
+// question to ask (nil once the tree is finished) and the products recommended so far, best first.
+type Result struct {
+	Complete        bool              `json:"complete"`
+	Answers         []*GivenAnswer    `json:"answers"`
+	Question        *Question         `json:"question"`
+	Recommendations []*Recommendation `json:"recommendations"`
+}
+
+// GivenAnswer . . .
+type GivenAnswer struct {
+	QuestionID string `json:"questionId"`
+	Question   string `json:"question"`
+	Value      string `json:"value"`
+	Label      string `json:"label"`
+}
+
+// Recommendation is a product matching every required filter, with the reasons for each filter it matched.
+// Score counts the preferred filters it matched.
+type Recommendation struct {
+	GUID   string `json:"guid"`
+	Handle string `json:"handle"`
+	SKU    string `json:"sku"`
+	Title  string `json:"title"`
+	money.Price
+	ImageURL string   `json:"imageURL"`
+	Reasons  []string `json:"reasons"`
+	Score    int      `json:"score"`
+}
+
+// Select follows t from its start with answers, which are keyed by question ID, and recommends the products
+// matching the filters of the answers followed, priced from the price list in currency and with titles in loc.
+func Select(t *Tree, answers map[string]string, currency string, loc string) (*Result, error) {
+	result := &Result{Answers: []*GivenAnswer{}, Recommendations: []*Recommendation{}}
+	filters := []*Filter{}
+	for id := t.Start; id != ""; {
+		q := t.question(id)
+		if q == nil {
+			return nil, fmt.Errorf("selector tree has no question %q", id)
+		}
+		value, ok := answers[q.ID]
+		value = strings.TrimSpace(value)
+		if !ok {
+			result.Question = q
+			break
+		}
+
+		a, err := q.answer(value)
+		if err != nil {
+			return nil, err
+		}
+		result.Answers = append(result.Answers, &GivenAnswer{QuestionID: q.ID, Question: q.Text, Value: value, Label: a.Label})
+		for _, f := range a.Filters {
+			resolved := *f
+			resolved.Value = strings.Replace(f.Value, AnswerValue, value, -1)
+			filters = append(filters, &resolved)
+		}
+		id = a.Next
+	}
+	result.Complete = result.Question == nil
+
+	candidates, err := product.GetActiveProducts()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range candidates {
+		if r := recommend(c, filters); r != nil {
+			result.Recommendations = append(result.Recommendations, r)
+		}
+	}
+
+	prices, err := pricelist.Get(currency)
+	if err != nil {
+		return nil, err
+	}
+	translations, err := locale.Get(loc)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range result.Recommendations {
+		r.Price = prices.Price(r.GUID, r.Price)
+		if title := translations.Product(r.GUID).Title; title.Valid {
+			r.Title = title.Chars
+		}
+	}
+
+	sort.SliceStable(result.Recommendations, func(i, j int) bool {
+		if result.Recommendations[i].Score != result.Recommendations[j].Score {
+			return result.Recommendations[i].Score > result.Recommendations[j].Score
+		}
+		return result.Recommendations[i].Handle < result.Recommendations[j].Handle
+	})
+
+	return result, nil
+}
+
+// answer returns the answer of q that value picks.
+func (q *Question) answer(value string) (*Answer, error) {
+	if q.Type == NumberQuestion {
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s must be a number", ErrInvalidAnswer, q.ID)
+		}
+		for _, a := range q.Answers {
+			if (a.Min == nil || n >= *a.Min) && (a.Max == nil || n < *a.Max) {
+				return a, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: %s cannot be %s", ErrInvalidAnswer, q.ID, value)
+	}
+
+	values := []string{}
+	for _, a := range q.Answers {
+		if strings.EqualFold(a.Value, strings.TrimSpace(value)) {
+			return a, nil
+		}
+		values = append(values, a.Value)
+	}
+	return nil, fmt.Errorf("%w: %s must be one of %s", ErrInvalidAnswer, q.ID, strings.Join(values, ", "))
+}
+
+// recommend returns c as a recommendation when it matches every required filter, or nil.
+func recommend(c *product.ActiveProduct, filters []*Filter) *Recommendation {
+	r := &Recommendation{
+		GUID:     c.GUID,
+		Handle:   c.Handle,
+		SKU:      c.SKU,
+		Title:    c.Title,
+		Price:    c.Price,
+		ImageURL: c.ImageURL,
+		Reasons:  []string{},
+	}
+	for _, f := range filters {
+		reason, ok := f.matches(c)
+		if !ok {
+			if !f.Preferred {
+				return nil
+			}
+			continue
+		}
+		if f.Preferred {
+			r.Score++
+		}
+		r.Reasons = append(r.Reasons, reason)
+	}
+	return r
+}
+
+// matches tells whether c matches f, and if so why.
+func (f *Filter) matches(c *product.ActiveProduct) (string, bool) {
+	if f.Tag != "" {
+		for _, tag := range c.Tags {
+			if strings.Contains(strings.ToLower(tag), strings.ToLower(f.Value)) {
+				return f.Reason, true
+			}
+		}
+		return "", false
+	}
+
+	// A product can have several specifications with the label, so any of them can match.
+	for _, s := range c.Specifications {
+		if strings.EqualFold(s.Label, f.Specification) && f.matchesValue(s.Value) {
+			return fmt.Sprintf("%s (%s: %s)", f.Reason, f.Specification, s.Value), true
+		}
+	}
+	return "", false
+}
+
+// matchesValue tells whether a specification value matches f.
+func (f *Filter) matchesValue(value string) bool {
+	switch f.Match {
+	case MatchContains:
+		return value != "" && strings.Contains(strings.ToLower(value), strings.ToLower(f.Value))
+	case MatchAtLeast, MatchAtMost:
+		want, err := strconv.ParseFloat(f.Value, 64)
+		have, ok := firstNumber(value)
+		if err == nil && ok {
+			return (f.Match == MatchAtLeast && have >= want) || (f.Match == MatchAtMost && have <= want)
+		}
+	}
+	return false
+}
+
+// firstNumber reads the first number in a specification value such as "72 dB" or "Up to 5,000 sq ft".
+func firstNumber(value string) (float64, bool) {
+	s := numberPattern.FindString(value)
+	if s == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(strings.Replace(s, ",", "", -1), 64)
+	return n, err == nil
+}
@@ -0,0 +1,357 @@
+package selector
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/cache"
+	"github.com/wilsonelectronics/productsapi/data"
+)
+
+const (
+	// ChoiceQuestion is answered with the Value of one of its answers.
+	ChoiceQuestion = "choice"
+	// NumberQuestion is answered with a number, which picks the answer whose range holds it.
+	NumberQuestion = "number"
+
+	// MatchContains matches a specification value or tag name containing Value, case insensitively.
+	MatchContains = "contains"
+	// MatchAtLeast matches a specification whose first number is at least Value.
+	MatchAtLeast = "atLeast"
+	// MatchAtMost matches a specification whose first number is at most Value.
+	MatchAtMost = "atMost"
+
+	// AnswerValue in a filter Value stands for the number given to a NumberQuestion.
+	AnswerValue = "{answer}"
+
+	treeCacheKey = "selectorTree"
+)
+
+// Tree is the decision tree of the selector. Questions are asked from Start, each answer leading to the
+// question named by its Next until an answer has none.
+type Tree struct {
+	Start     string      `json:"start"`
+	Questions []*Question `json:"questions"`
+}
+
+// Question . . .
+type Question struct {
+	ID      string    `json:"id"`
+	Text    string    `json:"text"`
+	Type    string    `json:"type"`
+	Unit    string    `json:"unit,omitempty"`
+	Answers []*Answer `json:"answers"`
+}
+
+// Answer is one way to answer a question. Choice answers are picked by Value; number answers by the range
+// from Min up to but not including Max, either of which may be left out.
+type Answer struct {
+	Value   string    `json:"value,omitempty"`
+	Label   string    `json:"label"`
+	Min     *float64  `json:"min,omitempty"`
+	Max     *float64  `json:"max,omitempty"`
+	Next    string    `json:"next,omitempty"`
+	Filters []*Filter `json:"filters,omitempty"`
+}
+
+// Filter narrows the recommended products by a specification or a tag name. Products must match every
+// filter that is not Preferred; Preferred filters only rank them. Reason says why a match suits the customer.
+type Filter struct {
+	Specification string `json:"specification,omitempty"`
+	Tag           string `json:"tag,omitempty"`
+	Match         string `json:"match"`
+	Value         string `json:"value"`
+	Preferred     bool   `json:"preferred,omitempty"`
+	Reason        string `json:"reason"`
+}
+
+// ValidationError lists every problem found with a tree.
+type ValidationError struct {
+	Problems []string `json:"problems"`
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid selector tree: " + strings.Join(e.Problems, "; ")
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+// DefaultTree is the tree used until one is saved.
+var DefaultTree = &Tree{
+	Start: "installation",
+	Questions: []*Question{
+		{
+			ID:   "installation",
+			Text: "Where will the booster be used?",
+			Type: ChoiceQuestion,
+			Answers: []*Answer{
+				{Value: "vehicle", Label: "In a vehicle", Next: "carriers", Filters: []*Filter{
+					{Specification: "Use Case", Match: MatchContains, Value: "Vehicle", Reason: "Made for vehicles"},
+				}},
+				{Value: "home", Label: "In a home", Next: "squareFootage", Filters: []*Filter{
+					{Specification: "Use Case", Match: MatchContains, Value: "Home", Reason: "Made for homes"},
+				}},
+				{Value: "building", Label: "In a business or large building", Next: "squareFootage", Filters: []*Filter{
+					{Specification: "Use Case", Match: MatchContains, Value: "Building", Reason: "Made for buildings"},
+				}},
+			},
+		},
+		{
+			ID:   "squareFootage",
+			Text: "How much space needs coverage?",
+			Type: NumberQuestion,
+			Unit: "sq ft",
+			Answers: []*Answer{
+				{Label: "Up to 5,000 sq ft", Max: float(5000), Next: "outsideSignal", Filters: []*Filter{
+					{Specification: "Coverage Area", Match: MatchAtLeast, Value: AnswerValue, Reason: "Covers the space"},
+				}},
+				{Label: "5,000 sq ft or more", Min: float(5000), Next: "outsideSignal", Filters: []*Filter{
+					{Specification: "Coverage Area", Match: MatchAtLeast, Value: AnswerValue, Reason: "Covers the space"},
+					{Tag: "Commercial", Match: MatchContains, Value: "Commercial", Preferred: true, Reason: "Built for commercial installs"},
+				}},
+			},
+		},
+		{
+			ID:   "outsideSignal",
+			Text: "How strong is the signal outside?",
+			Type: ChoiceQuestion,
+			Answers: []*Answer{
+				{Value: "strong", Label: "Strong (3 or more bars)", Next: "carriers"},
+				{Value: "moderate", Label: "Moderate (1 to 2 bars)", Next: "carriers", Filters: []*Filter{
+					{Specification: "Gain", Match: MatchAtLeast, Value: "65", Reason: "Enough gain for a moderate outside signal"},
+				}},
+				{Value: "weak", Label: "Weak (0 to 1 bar)", Next: "carriers", Filters: []*Filter{
+					{Specification: "Gain", Match: MatchAtLeast, Value: "70", Reason: "Enough gain for a weak outside signal"},
+				}},
+			},
+		},
+		{
+			ID:   "carriers",
+			Text: "How many carriers need a better signal?",
+			Type: NumberQuestion,
+			Answers: []*Answer{
+				{Label: "One", Max: float(2)},
+				{Label: "Two or more", Min: float(2), Filters: []*Filter{
+					{Tag: "All Carriers", Match: MatchContains, Value: "All Carriers", Preferred: true, Reason: "Boosts every carrier at once"},
+				}},
+			},
+		},
+	},
+}
+
+// GetTree returns the saved tree, or DefaultTree when none has been saved.
+func GetTree() (*Tree, error) {
+	bytes, err := cache.Retrieve(treeCacheKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes == nil {
+		return getTreeFromDbAndCache()
+	}
+
+	t := &Tree{}
+	err = json.Unmarshal(bytes, t)
+	return t, err
+}
+
+// SaveTree validates t and saves it in place of the current tree.
+func SaveTree(t *Tree) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	treeJSON, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err = db.Exec("set nocount on; exec [spcSelectorTreeSet] ?", string(treeJSON)); err != nil {
+		return fmt.Errorf("spcSelectorTreeSet failed: %s", err)
+	}
+
+	cache.Delete(treeCacheKey)
+	return nil
+}
+
+// Validate checks that every question can be reached from Start, answers lead to existing questions without
+// looping back, and filters are complete.
+func (t *Tree) Validate() error {
+	problems := []string{}
+	questions := map[string]*Question{}
+	for i, q := range t.Questions {
+		if strings.TrimSpace(q.ID) == "" {
+			problems = append(problems, fmt.Sprintf("questions[%d].id is required", i))
+			continue
+		}
+		if _, ok := questions[q.ID]; ok {
+			problems = append(problems, fmt.Sprintf("questions[%d].id %q is repeated", i, q.ID))
+		}
+		questions[q.ID] = q
+		problems = append(problems, validateQuestion(q)...)
+	}
+
+	if _, ok := questions[t.Start]; !ok {
+		problems = append(problems, fmt.Sprintf("start question %q does not exist", t.Start))
+	} else {
+		reached := map[string]bool{}
+		if cycle := findCycle(t.Start, questions, map[string]bool{}, reached); cycle != "" {
+			problems = append(problems, fmt.Sprintf("question %q can be asked twice", cycle))
+		}
+		for _, q := range t.Questions {
+			if q.ID != "" && !reached[q.ID] {
+				problems = append(problems, fmt.Sprintf("question %q cannot be reached from %q", q.ID, t.Start))
+			}
+		}
+	}
+	for _, q := range t.Questions {
+		for j, a := range q.Answers {
+			if _, ok := questions[a.Next]; a.Next != "" && !ok {
+				problems = append(problems, fmt.Sprintf("%s answers[%d].next %q does not exist", q.ID, j, a.Next))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func validateQuestion(q *Question) []string {
+	problems := []string{}
+	if strings.TrimSpace(q.Text) == "" {
+		problems = append(problems, fmt.Sprintf("%s text is required", q.ID))
+	}
+	if q.Type != ChoiceQuestion && q.Type != NumberQuestion {
+		problems = append(problems, fmt.Sprintf("%s type must be %s or %s", q.ID, ChoiceQuestion, NumberQuestion))
+	}
+	if len(q.Answers) == 0 {
+		problems = append(problems, fmt.Sprintf("%s needs at least one answer", q.ID))
+	}
+
+	values := map[string]bool{}
+	for j, a := range q.Answers {
+		switch q.Type {
+		case ChoiceQuestion:
+			if strings.TrimSpace(a.Value) == "" || values[a.Value] {
+				problems = append(problems, fmt.Sprintf("%s answers[%d].value must be unique and not empty", q.ID, j))
+			}
+			values[a.Value] = true
+		case NumberQuestion:
+			if a.Min != nil && a.Max != nil && *a.Min >= *a.Max {
+				problems = append(problems, fmt.Sprintf("%s answers[%d].min must be less than max", q.ID, j))
+			}
+			for k, b := range q.Answers[:j] {
+				if overlaps(a, b) {
+					problems = append(problems, fmt.Sprintf("%s answers[%d] overlaps answers[%d]", q.ID, j, k))
+				}
+			}
+		}
+
+		for k, f := range a.Filters {
+			field := fmt.Sprintf("%s answers[%d].filters[%d]", q.ID, j, k)
+			if (f.Specification == "") == (f.Tag == "") {
+				problems = append(problems, field+" needs exactly one of specification or tag")
+			}
+			switch f.Match {
+			case MatchContains:
+			case MatchAtLeast, MatchAtMost:
+				if f.Tag != "" {
+					problems = append(problems, field+" can only match tags with "+MatchContains)
+				}
+				if _, err := strconv.ParseFloat(f.Value, 64); err != nil && !(f.Value == AnswerValue && q.Type == NumberQuestion) {
+					problems = append(problems, field+".value must be a number")
+				}
+			default:
+				problems = append(problems, fmt.Sprintf("%s.match must be %s, %s or %s", field, MatchContains, MatchAtLeast, MatchAtMost))
+			}
+			if f.Value == "" {
+				problems = append(problems, field+".value is required")
+			}
+			if strings.TrimSpace(f.Reason) == "" {
+				problems = append(problems, field+".reason is required")
+			}
+		}
+	}
+	return problems
+}
+
+func overlaps(a, b *Answer) bool {
+	aBelowB := a.Max != nil && b.Min != nil && *a.Max <= *b.Min
+	bBelowA := b.Max != nil && a.Min != nil && *b.Max <= *a.Min
+	return !aBelowB && !bBelowA
+}
+
+// findCycle walks the questions from id, recording those reached, and returns a question that can be reached
+// from itself.
+func findCycle(id string, questions map[string]*Question, path map[string]bool, reached map[string]bool) string {
+	if path[id] {
+		return id
+	}
+	q, ok := questions[id]
+	if !ok || reached[id] {
+		return ""
+	}
+	reached[id] = true
+
+	path[id] = true
+	defer delete(path, id)
+	for _, a := range q.Answers {
+		if a.Next == "" {
+			continue
+		}
+		if cycle := findCycle(a.Next, questions, path, reached); cycle != "" {
+			return cycle
+		}
+	}
+	return ""
+}
+
+func (t *Tree) question(id string) *Question {
+	for _, q := range t.Questions {
+		if q.ID == id {
+			return q
+		}
+	}
+	return nil
+}
+
+func getTreeFromDbAndCache() (*Tree, error) {
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	t := DefaultTree
+	var treeJSON string
+	err = db.QueryRow("set nocount on; exec [spcSelectorTreeGet]").Scan(&treeJSON)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("spcSelectorTreeGet failed: %s", err)
+	} else if err == nil {
+		t = &Tree{}
+		if err = json.Unmarshal([]byte(treeJSON), t); err != nil {
+			return nil, fmt.Errorf("saved selector tree is not valid JSON: %s", err)
+		}
+	}
+
+	bytes, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	cache.Store(treeCacheKey, bytes)
+
+	return t, nil
+}
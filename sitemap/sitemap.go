@@ -0,0 +1,178 @@
+package sitemap
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wilsonelectronics/productsapi/blog"
+	"github.com/wilsonelectronics/productsapi/cache"
+	"github.com/wilsonelectronics/productsapi/category"
+	"github.com/wilsonelectronics/productsapi/product"
+)
+
+const (
+	// MaxURLs is the most URLs the sitemap protocol allows in one file.
+	MaxURLs = 50000
+
+	cacheKey     = cache.SitemapKey
+	cacheTTL     = time.Hour
+	categoryPath = "/categories/"
+	blogPath     = "/blog/"
+	namespace    = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	dateLayout   = "2006-01-02"
+)
+
+// URL . . .
+type URL struct {
+	Loc     string `xml:"loc" json:"loc"`
+	LastMod string `xml:"lastmod,omitempty" json:"lastmod,omitempty"`
+}
+
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	NS      string   `xml:"xmlns,attr"`
+	URLs    []*URL   `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name `xml:"sitemapindex"`
+	NS       string   `xml:"xmlns,attr"`
+	Sitemaps []*URL   `xml:"sitemap"`
+}
+
+// WriteIndexOrSitemap writes the whole sitemap when it fits in one file, otherwise a sitemap index pointing
+// at /sitemap-1.xml, /sitemap-2.xml and so on.
+func WriteIndexOrSitemap(w io.Writer) error {
+	urls, err := getURLs()
+	if err != nil {
+		return err
+	}
+
+	if pages(urls) <= 1 {
+		return write(w, &urlSet{NS: namespace, URLs: urls})
+	}
+
+	siteURL := strings.TrimRight(os.Getenv("SITE_URL"), "/")
+	index := &sitemapIndex{NS: namespace, Sitemaps: []*URL{}}
+	for page := 1; page <= pages(urls); page++ {
+		index.Sitemaps = append(index.Sitemaps, &URL{Loc: fmt.Sprintf("%s/sitemap-%d.xml", siteURL, page), LastMod: latest(pageURLs(urls, page))})
+	}
+	return write(w, index)
+}
+
+// WritePage writes one file of a split sitemap, numbered from 1. ok is false when there is no such page.
+func WritePage(w io.Writer, page int) (ok bool, err error) {
+	urls, err := getURLs()
+	if err != nil {
+		return false, err
+	}
+
+	if page < 1 || page > pages(urls) {
+		return false, nil
+	}
+	return true, write(w, &urlSet{NS: namespace, URLs: pageURLs(urls, page)})
+}
+
+func pages(urls []*URL) int {
+	return (len(urls) + MaxURLs - 1) / MaxURLs
+}
+
+func pageURLs(urls []*URL, page int) []*URL {
+	end := page * MaxURLs
+	if end > len(urls) {
+		end = len(urls)
+	}
+	return urls[(page-1)*MaxURLs : end]
+}
+
+func latest(urls []*URL) string {
+	last := ""
+	for _, u := range urls {
+		if u.LastMod > last {
+			last = u.LastMod
+		}
+	}
+	return last
+}
+
+func write(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func getURLs() ([]*URL, error) {
+	bytes, err := cache.Retrieve(cacheKey)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := []*URL{}
+	if bytes != nil {
+		err = json.Unmarshal(bytes, &urls)
+		return urls, err
+	}
+
+	if urls, err = buildURLs(); err != nil {
+		return nil, err
+	}
+
+	urlsJSON, err := json.Marshal(urls)
+	if err != nil {
+		return nil, err
+	}
+	cache.StoreFor(cacheKey, urlsJSON, cacheTTL)
+
+	return urls, nil
+}
+
+func buildURLs() ([]*URL, error) {
+	siteURL := strings.TrimRight(os.Getenv("SITE_URL"), "/")
+	urls := []*URL{}
+
+	err := product.Walk(func(p *product.Product) error {
+		if p.Details.IsActive && !p.Details.IsDeleted {
+			urls = append(urls, &URL{Loc: product.PageURL(p.Details.Handle), LastMod: lastMod(p.Details.ModifiedTime)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := category.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range categories {
+		urls = append(urls, &URL{Loc: siteURL + categoryPath + c.Handle})
+	}
+
+	posts, err := blog.GetAllPublishedPosts()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range posts {
+		u := &URL{Loc: siteURL + blogPath + strings.TrimPrefix(p.Slug, "/")}
+		if p.PublishDate > 0 {
+			u.LastMod = time.Unix(0, p.PublishDate*int64(time.Millisecond)).UTC().Format(dateLayout)
+		}
+		urls = append(urls, u)
+	}
+
+	return urls, nil
+}
+
+// lastMod converts a product ModifiedTime to the W3C date sitemaps use, or "" when it cannot be read.
+func lastMod(modifiedTime string) string {
+	if t := product.ParseModifiedTime(modifiedTime); !t.IsZero() {
+		return t.UTC().Format(dateLayout)
+	}
+	return ""
+}
@@ -0,0 +1,477 @@
+package spec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/cache"
+	"github.com/wilsonelectronics/productsapi/data"
+	"github.com/wilsonelectronics/productsapi/strslice"
+)
+
+// Data types of specification values.
+const (
+	// TypeText is free-form text, the type of specifications without a definition.
+	TypeText = "text"
+	// TypeNumber is a number with an optional unit, e.g. "72 dB".
+	TypeNumber = "number"
+	// TypeRange is a range of numbers with an optional unit, e.g. "698-2700 MHz".
+	TypeRange = "range"
+	// TypeEnum is one of the definition's Values.
+	TypeEnum = "enum"
+	// TypeBoolean is yes or no.
+	TypeBoolean = "boolean"
+	// TypeList is a comma separated list, limited to the definition's Values when it has any.
+	TypeList = "list"
+
+	schemaCacheKey = "specificationSchema"
+)
+
+var types = []string{TypeText, TypeNumber, TypeRange, TypeEnum, TypeBoolean, TypeList}
+
+// ErrInvalidValue is returned when a value cannot be read as its specification's type.
+var ErrInvalidValue = errors.New("invalid specification value")
+
+var (
+	numberPattern = regexp.MustCompile(`^([-+]?\d[\d,]*(?:\.\d+)?|[-+]?\.\d+)\s*(.*)$`)
+	// Longer qualifiers come first, so "maximum" is not read as "max" followed by "imum".
+	qualifiers     = []string{"up to", "maximum", "max", "minimum", "min", "approximately", "approx", "~"}
+	listSeparators = regexp.MustCompile(`\s*[,;|]\s*`)
+	trueWords      = []string{"yes", "y", "true", "1", "included"}
+	falseWords     = []string{"no", "n", "false", "0", "not included"}
+)
+
+// Definition is the schema of a specification for a product type. Unit is the normalized unit number and
+// range values are converted to, if any. Together a product type's definitions are its template: products
+// of the type must have the Required ones, and show them in Group by Order.
+type Definition struct {
+	ProductTypeID   int      `json:"productTypeId"`
+	SpecificationID int      `json:"specificationId"`
+	Label           string   `json:"label"`
+	Type            string   `json:"type"`
+	Unit            string   `json:"unit,omitempty"`
+	Values          []string `json:"values,omitempty"`
+	Required        bool     `json:"required"`
+	Group           string   `json:"group,omitempty"`
+	Order           int      `json:"order"`
+}
+
+// Schema holds the definitions of every product type, by product type and then Order.
+type Schema struct {
+	Definitions []*Definition `json:"definitions"`
+}
+
+// Template is the specifications of a product type in their groups, each group placed where its first
+// specification is ordered.
+type Template struct {
+	ProductTypeID int              `json:"productTypeId"`
+	Groups        []*TemplateGroup `json:"groups"`
+}
+
+// TemplateGroup . . .
+type TemplateGroup struct {
+	Name           string        `json:"name"`
+	Specifications []*Definition `json:"specifications"`
+}
+
+// Value is a specification value read as its definition's type. Only the fields of Type are set: Number for
+// numbers, Min and Max for ranges, Boolean, Text for enums and text, and List.
+type Value struct {
+	Type    string   `json:"type"`
+	Number  *float64 `json:"number,omitempty"`
+	Min     *float64 `json:"min,omitempty"`
+	Max     *float64 `json:"max,omitempty"`
+	Unit    string   `json:"unit,omitempty"`
+	Boolean *bool    `json:"boolean,omitempty"`
+	Text    string   `json:"text,omitempty"`
+	List    []string `json:"list,omitempty"`
+}
+
+// GetSchema . . .
+func GetSchema() (*Schema, error) {
+	bytes, err := cache.Retrieve(schemaCacheKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes == nil {
+		return getSchemaFromDbAndCache()
+	}
+
+	s := &Schema{}
+	err = json.Unmarshal(bytes, s)
+	return s, err
+}
+
+// Definition returns the definition of a specification for a product type. It is nil when the product type
+// does not define the specification, so its values are read as text.
+func (s *Schema) Definition(productTypeID int, specificationID int) *Definition {
+	for _, d := range s.Definitions {
+		if d.ProductTypeID == productTypeID && d.SpecificationID == specificationID {
+			return d
+		}
+	}
+	return nil
+}
+
+// ForProductType returns the definitions of a product type, or of every product type when productTypeID is 0.
+func (s *Schema) ForProductType(productTypeID int) []*Definition {
+	definitions := []*Definition{}
+	for _, d := range s.Definitions {
+		if productTypeID == 0 || d.ProductTypeID == productTypeID {
+			definitions = append(definitions, d)
+		}
+	}
+	return definitions
+}
+
+// Templates returns the template of the productTypeID product type, or of every product type that has
+// definitions when productTypeID is 0.
+func (s *Schema) Templates(productTypeID int) []*Template {
+	templates := []*Template{}
+	for _, d := range s.ForProductType(productTypeID) {
+		if len(templates) == 0 || templates[len(templates)-1].ProductTypeID != d.ProductTypeID {
+			templates = append(templates, &Template{ProductTypeID: d.ProductTypeID, Groups: []*TemplateGroup{}})
+		}
+		t := templates[len(templates)-1]
+
+		var group *TemplateGroup
+		for _, g := range t.Groups {
+			if g.Name == d.Group {
+				group = g
+				break
+			}
+		}
+		if group == nil {
+			group = &TemplateGroup{Name: d.Group, Specifications: []*Definition{}}
+			t.Groups = append(t.Groups, group)
+		}
+		group.Specifications = append(group.Specifications, d)
+	}
+	return templates
+}
+
+// Type reads raw as the type defined for a specification of a product type. Values of undefined
+// specifications, and values that do not match their definition, are text.
+func (s *Schema) Type(productTypeID int, specificationID int, raw string) *Value {
+	if d := s.Definition(productTypeID, specificationID); d != nil {
+		if v, err := d.Parse(raw); err == nil {
+			return v
+		}
+	}
+	return &Value{Type: TypeText, Text: strings.TrimSpace(raw)}
+}
+
+// Parse reads raw as the type of d, converting numbers to d.Unit.
+func (d *Definition) Parse(raw string) (*Value, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, fmt.Errorf("%w: %s is empty", ErrInvalidValue, d.Label)
+	}
+
+	switch d.Type {
+	case TypeNumber:
+		n, unit, err := d.parseNumber(raw)
+		if err != nil {
+			return nil, err
+		}
+		return &Value{Type: TypeNumber, Number: &n, Unit: unit}, nil
+	case TypeRange:
+		return d.parseRange(raw)
+	case TypeEnum:
+		value, ok := d.allowed(raw)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s must be one of %s", ErrInvalidValue, d.Label, strings.Join(d.Values, ", "))
+		}
+		return &Value{Type: TypeEnum, Text: value}, nil
+	case TypeBoolean:
+		for _, w := range trueWords {
+			if strings.EqualFold(raw, w) {
+				b := true
+				return &Value{Type: TypeBoolean, Boolean: &b}, nil
+			}
+		}
+		for _, w := range falseWords {
+			if strings.EqualFold(raw, w) {
+				b := false
+				return &Value{Type: TypeBoolean, Boolean: &b}, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: %s must be yes or no", ErrInvalidValue, d.Label)
+	case TypeList:
+		list := []string{}
+		for _, item := range listSeparators.Split(raw, -1) {
+			if item == "" {
+				continue
+			}
+			value, ok := d.allowed(item)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s cannot list %q", ErrInvalidValue, d.Label, item)
+			}
+			list = append(list, value)
+		}
+		return &Value{Type: TypeList, List: list}, nil
+	}
+	return &Value{Type: TypeText, Text: raw}, nil
+}
+
+// parseNumber reads a number such as "72 dB", "Up to 5,000 sq ft" or "2.7 GHz", returning it in d.Unit.
+// A number written without a unit is taken to be in d.Unit already.
+func (d *Definition) parseNumber(raw string) (float64, string, error) {
+	s := strings.TrimSpace(raw)
+	for _, q := range qualifiers {
+		if strings.HasPrefix(strings.ToLower(s), q) {
+			s = strings.TrimSpace(s[len(q):])
+			break
+		}
+	}
+
+	m := numberPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, "", fmt.Errorf("%w: %s %q is not a number", ErrInvalidValue, d.Label, raw)
+	}
+	n, err := strconv.ParseFloat(strings.Replace(m[1], ",", "", -1), 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: %s %q is not a number", ErrInvalidValue, d.Label, raw)
+	}
+
+	written := strings.TrimSpace(m[2])
+	if written == "" {
+		return n, d.Unit, nil
+	}
+	c, ok := lookupUnit(written)
+	if !ok {
+		return 0, "", fmt.Errorf("%w: %s has unknown unit %q", ErrInvalidValue, d.Label, written)
+	}
+	if d.Unit != "" && c.unit != d.Unit {
+		return 0, "", fmt.Errorf("%w: %s must be in %s, not %s", ErrInvalidValue, d.Label, d.Unit, written)
+	}
+	return round(n * c.factor), c.unit, nil
+}
+
+// parseRange reads a range such as "698-2700 MHz", "0.7 GHz to 2.7 GHz" or "-50 – -20 dBm". A unit written
+// only after the upper bound applies to both.
+func (d *Definition) parseRange(raw string) (*Value, error) {
+	low, high, ok := splitRange(raw)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %q is not a range", ErrInvalidValue, d.Label, raw)
+	}
+
+	max, unit, err := d.parseNumber(high)
+	if err != nil {
+		return nil, err
+	}
+	lowMatch := numberPattern.FindStringSubmatch(strings.TrimSpace(low))
+	highMatch := numberPattern.FindStringSubmatch(strings.TrimSpace(high))
+	if lowMatch != nil && highMatch != nil && strings.TrimSpace(lowMatch[2]) == "" {
+		low += " " + highMatch[2]
+	}
+	min, lowUnit, err := d.parseNumber(low)
+	if err != nil {
+		return nil, err
+	}
+	if lowUnit != unit {
+		return nil, fmt.Errorf("%w: %s %q mixes units", ErrInvalidValue, d.Label, raw)
+	}
+	if min > max {
+		return nil, fmt.Errorf("%w: %s %q ends before it starts", ErrInvalidValue, d.Label, raw)
+	}
+
+	return &Value{Type: TypeRange, Min: &min, Max: &max, Unit: unit}, nil
+}
+
+// splitRange splits raw at " to ", an en dash, or a hyphen that follows a digit or unit rather than
+// starting a negative number.
+func splitRange(raw string) (string, string, bool) {
+	lower := strings.ToLower(raw)
+	if i := strings.Index(lower, " to "); i > 0 {
+		return raw[:i], raw[i+4:], true
+	}
+	if i := strings.Index(raw, "–"); i > 0 {
+		return raw[:i], raw[i+len("–"):], true
+	}
+	for i := 1; i < len(raw); i++ {
+		if raw[i] != '-' {
+			continue
+		}
+		before := strings.TrimSpace(raw[:i])
+		if before != "" && before != "-" {
+			return raw[:i], raw[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+func (d *Definition) allowed(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if len(d.Values) == 0 {
+		return value, true
+	}
+	for _, v := range d.Values {
+		if strings.EqualFold(v, value) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// Bounds returns the lowest and highest amounts of a number or range value.
+func (v *Value) Bounds() (float64, float64, bool) {
+	switch {
+	case v == nil:
+		return 0, 0, false
+	case v.Number != nil:
+		return *v.Number, *v.Number, true
+	case v.Min != nil && v.Max != nil:
+		return *v.Min, *v.Max, true
+	}
+	return 0, 0, false
+}
+
+// Equal reports whether v and o are the same value, comparing numbers after unit normalization and text case
+// insensitively.
+func (v *Value) Equal(o *Value) bool {
+	if v == nil || o == nil {
+		return v == o
+	}
+	if v.Type != o.Type || v.Unit != o.Unit {
+		return false
+	}
+	vMin, vMax, vNumeric := v.Bounds()
+	oMin, oMax, oNumeric := o.Bounds()
+	if vNumeric || oNumeric {
+		return vNumeric && oNumeric && vMin == oMin && vMax == oMax
+	}
+	if (v.Boolean == nil) != (o.Boolean == nil) || (v.Boolean != nil && *v.Boolean != *o.Boolean) {
+		return false
+	}
+	if len(v.List) != len(o.List) {
+		return false
+	}
+	for i := range v.List {
+		if !strings.EqualFold(v.List[i], o.List[i]) {
+			return false
+		}
+	}
+	return strings.EqualFold(v.Text, o.Text)
+}
+
+// String writes v in its normalized form, e.g. "72 dB" or "698-2700 MHz".
+func (v *Value) String() string {
+	withUnit := func(s string) string {
+		if v.Unit == "" {
+			return s
+		}
+		return s + " " + v.Unit
+	}
+
+	switch {
+	case v.Number != nil:
+		return withUnit(formatNumber(*v.Number))
+	case v.Min != nil && v.Max != nil:
+		separator := "-"
+		if *v.Min < 0 || *v.Max < 0 {
+			separator = " to "
+		}
+		return withUnit(formatNumber(*v.Min) + separator + formatNumber(*v.Max))
+	case v.Boolean != nil && *v.Boolean:
+		return "Yes"
+	case v.Boolean != nil:
+		return "No"
+	case v.List != nil:
+		return strings.Join(v.List, ", ")
+	}
+	return v.Text
+}
+
+// IsNumeric reports whether values of type t are numbers or ranges.
+func IsNumeric(t string) bool {
+	return t == TypeNumber || t == TypeRange
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// round drops the floating point noise unit conversions leave, e.g. 2.7 GHz becoming 2700.0000000000005 MHz.
+func round(n float64) float64 {
+	return math.Round(n*1e6) / 1e6
+}
+
+func getSchemaFromDbAndCache() (*Schema, error) {
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("set nocount on; exec [spcSpecificationSchemaGet]")
+	if err != nil {
+		return nil, fmt.Errorf("spcSpecificationSchemaGet Query failed: %s", err)
+	}
+	defer rows.Close()
+
+	s := &Schema{Definitions: []*Definition{}}
+	for rows.Next() {
+		d := &Definition{}
+		if err = rows.Scan(
+			&d.ProductTypeID,
+			&d.SpecificationID,
+			&d.Label,
+			&d.Type,
+			&d.Unit,
+			&d.Required,
+			&d.Group,
+			&d.Order); err != nil {
+			return nil, fmt.Errorf("spcSpecificationSchemaGet Query Scan failed: %s", err)
+		}
+		if !strslice.Contains(types, d.Type) {
+			d.Type = TypeText
+		}
+		if unit := NormalizeUnit(d.Unit); unit != "" {
+			d.Unit = unit
+		}
+		s.Definitions = append(s.Definitions, d)
+	}
+	sort.SliceStable(s.Definitions, func(i, j int) bool {
+		a, b := s.Definitions[i], s.Definitions[j]
+		if a.ProductTypeID != b.ProductTypeID {
+			return a.ProductTypeID < b.ProductTypeID
+		}
+		return a.Order < b.Order
+	})
+
+	valueRows, err := db.Query("set nocount on; exec [spcSpecificationSchemaValuesGet]")
+	if err != nil {
+		return nil, fmt.Errorf("spcSpecificationSchemaValuesGet Query failed: %s", err)
+	}
+	defer valueRows.Close()
+
+	// Rows come one per allowed value of a product type's specification, in display order.
+	for valueRows.Next() {
+		var productTypeID, specificationID int
+		var value string
+		if err = valueRows.Scan(&productTypeID, &specificationID, &value); err != nil {
+			return nil, fmt.Errorf("spcSpecificationSchemaValuesGet Query Scan failed: %s", err)
+		}
+		for _, d := range s.Definitions {
+			if d.ProductTypeID == productTypeID && d.SpecificationID == specificationID {
+				d.Values = append(d.Values, value)
+			}
+		}
+	}
+
+	schemaJSON, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	cache.Store(schemaCacheKey, schemaJSON)
+
+	return s, nil
+}
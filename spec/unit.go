@@ -0,0 +1,64 @@
+package spec
+
+import "strings"
+
+// Units values are normalized to. Each measures something different, so values are never converted
+// between them.
+const (
+	// Decibels . . .
+	Decibels = "dB"
+	// DecibelMilliwatts . . .
+	DecibelMilliwatts = "dBm"
+	// Megahertz . . .
+	Megahertz = "MHz"
+	// SquareFeet . . .
+	SquareFeet = "sq ft"
+)
+
+// conversion turns an amount in some unit into an amount of one of the normalized units.
+type conversion struct {
+	unit   string
+	factor float64
+}
+
+// unitAliases maps the ways units are written, lower cased and without dots, to their normalized unit.
+var unitAliases = map[string]conversion{
+	"db":             {Decibels, 1},
+	"dbm":            {DecibelMilliwatts, 1},
+	"mhz":            {Megahertz, 1},
+	"ghz":            {Megahertz, 1000},
+	"khz":            {Megahertz, 0.001},
+	"sq ft":          {SquareFeet, 1},
+	"sqft":           {SquareFeet, 1},
+	"sf":             {SquareFeet, 1},
+	"ft2":            {SquareFeet, 1},
+	"ft²":            {SquareFeet, 1},
+	"square feet":    {SquareFeet, 1},
+	"square foot":    {SquareFeet, 1},
+	"sq m":           {SquareFeet, 10.7639},
+	"m2":             {SquareFeet, 10.7639},
+	"m²":             {SquareFeet, 10.7639},
+	"square meters":  {SquareFeet, 10.7639},
+	"square metres":  {SquareFeet, 10.7639},
+	"square meter":   {SquareFeet, 10.7639},
+	"square metre":   {SquareFeet, 10.7639},
+	"sq meters":      {SquareFeet, 10.7639},
+	"sq metres":      {SquareFeet, 10.7639},
+	"square footage": {SquareFeet, 1},
+}
+
+// lookupUnit returns the conversion for a unit as written, such as "GHz" or "sq. ft.".
+func lookupUnit(written string) (conversion, bool) {
+	key := strings.ToLower(strings.Join(strings.Fields(strings.Replace(written, ".", "", -1)), " "))
+	c, ok := unitAliases[key]
+	return c, ok
+}
+
+// NormalizeUnit returns the normalized unit for a unit as written, or "" when it is not a known unit.
+func NormalizeUnit(written string) string {
+	c, ok := lookupUnit(written)
+	if !ok {
+		return ""
+	}
+	return c.unit
+}
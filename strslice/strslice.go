@@ -0,0 +1,24 @@
+// Package strslice holds the string slice helpers shared by the other packages.
+package strslice
+
+import "strings"
+
+// Contains reports whether value is one of values.
+func Contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsFold reports whether value is one of values, ignoring case.
+func ContainsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
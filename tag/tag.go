@@ -6,6 +6,11 @@ import (
 
 	"github.com/wilsonelectronics/productsapi/cache"
 	"github.com/wilsonelectronics/productsapi/data"
+	"github.com/wilsonelectronics/productsapi/inventory"
+	"github.com/wilsonelectronics/productsapi/locale"
+	"github.com/wilsonelectronics/productsapi/money"
+	"github.com/wilsonelectronics/productsapi/pricelist"
+	"github.com/wilsonelectronics/productsapi/rendition"
 
 	"github.com/piotrkowalczuk/ntypes"
 )
@@ -29,12 +34,14 @@ type Product struct {
 	Title            string        `json:"title"`
 	TitleTag         ntypes.String `json:"titleTag"`
 	BodyHTML         ntypes.String `json:"bodyHtml"`
-	Price            float64       `json:"price"`
-	ImageURL         string        `json:"imageURL"`
-	Handle           string        `json:"handle"`
-	ModifiedTime     string        `json:"modifiedTime"`
-	IsActive         bool          `json:"isActive"`
-	IsDeleted        bool          `json:"isDeleted"`
+	money.Price
+	ImageURL     string                  `json:"imageURL"`
+	ImageSet     *rendition.Set          `json:"imageSet,omitempty"`
+	Availability *inventory.Availability `json:"availability,omitempty"`
+	Handle       string                  `json:"handle"`
+	ModifiedTime string                  `json:"modifiedTime"`
+	IsActive     bool                    `json:"isActive"`
+	IsDeleted    bool                    `json:"isDeleted"`
 }
 
 // GetAll . . .
@@ -53,6 +60,52 @@ func GetAll() ([]*Tag, error) {
 	return tags, err
 }
 
+// GetLocalizedProductsByID returns the products of a tag with their text in loc, falling back to
+// locale.Default, priced from the price list in currency and with their image renditions and availability.
+func GetLocalizedProductsByID(tagID string, currency string, loc string) ([]*Product, error) {
+	products, err := GetProductsByID(tagID)
+	if err != nil {
+		return nil, err
+	}
+
+	prices, err := pricelist.Get(currency)
+	if err != nil {
+		return nil, err
+	}
+	t, err := locale.Get(loc)
+	if err != nil {
+		return nil, err
+	}
+	skus := []string{}
+	for _, p := range products {
+		skus = append(skus, p.SKU)
+	}
+	inv, err := inventory.Get(skus...)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range products {
+		p.Price = prices.Price(p.GUID, p.Price)
+		p.ImageSet = rendition.For(p.ImageURL)
+		p.Availability = inv.Summary(p.SKU)
+
+		texts := t.Product(p.GUID)
+		if texts.Title.Valid {
+			p.Title = texts.Title.Chars
+		}
+		if texts.Description.Valid {
+			p.Description = texts.Description.Chars
+		}
+		if texts.DescriptionShort.Valid {
+			p.DescriptionShort = texts.DescriptionShort
+		}
+		if texts.BodyHTML.Valid {
+			p.BodyHTML = texts.BodyHTML
+		}
+	}
+	return products, nil
+}
+
 // GetProductsByID . . .
 func GetProductsByID(tagID string) ([]*Product, error) {
 	bytes, err := cache.Retrieve(tagID)
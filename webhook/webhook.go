@@ -0,0 +1,237 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/wilsonelectronics/productsapi/data"
+	"github.com/wilsonelectronics/productsapi/strslice"
+
+	"github.com/piotrkowalczuk/ntypes"
+)
+
+const (
+	// ProductUpdated . . .
+	ProductUpdated = "product.updated"
+	// PriceChanged . . .
+	PriceChanged = "price.changed"
+	// ProductDeactivated is sent when a product is deactivated or deleted.
+	ProductDeactivated = "product.deactivated"
+	// CategoryMembershipChanged . . .
+	CategoryMembershipChanged = "category.membership.changed"
+
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the timestamp, a dot and the body, keyed
+	// with the subscription's secret.
+	SignatureHeader = "X-Webhook-Signature"
+	// TimestampHeader carries the Unix time the delivery attempt was signed at.
+	TimestampHeader = "X-Webhook-Timestamp"
+	// EventHeader . . .
+	EventHeader = "X-Webhook-Event"
+
+	// StatusPending . . .
+	StatusPending = "pending"
+	// StatusDelivered . . .
+	StatusDelivered = "delivered"
+	// StatusDead marks a delivery that failed every attempt; it stays in the dead-letter list until redelivered.
+	StatusDead = "dead"
+)
+
+// EventTypes lists every event a subscription can ask for.
+var EventTypes = []string{ProductUpdated, PriceChanged, ProductDeactivated, CategoryMembershipChanged}
+
+// ErrNotFound . . .
+var ErrNotFound = errors.New("webhook not found")
+
+// Subscription . . .
+type Subscription struct {
+	ID          int64    `json:"id"`
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"eventTypes"`
+	Secret      string   `json:"secret,omitempty"`
+	IsActive    bool     `json:"isActive"`
+	CreatedTime string   `json:"createdTime"`
+}
+
+// Delivery is one event sent, or to be sent, to one subscription.
+type Delivery struct {
+	ID              int64         `json:"id"`
+	SubscriptionID  int64         `json:"subscriptionId"`
+	EventType       string        `json:"eventType"`
+	EventID         int64         `json:"eventId"`
+	Status          string        `json:"status"`
+	Attempts        int           `json:"attempts"`
+	NextAttemptTime ntypes.String `json:"nextAttemptTime"`
+	ResponseStatus  ntypes.Int32  `json:"responseStatus"`
+	LastError       ntypes.String `json:"lastError"`
+	CreatedTime     string        `json:"createdTime"`
+	UpdatedTime     string        `json:"updatedTime"`
+}
+
+// Subscribe registers url for eventTypes and returns the subscription with its signing secret, which is not
+// shown again.
+func Subscribe(rawURL string, eventTypes []string) (*Subscription, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("url must be an absolute https URL")
+	}
+	if len(eventTypes) == 0 {
+		return nil, fmt.Errorf("at least one event type is required")
+	}
+	for _, t := range eventTypes {
+		if !strslice.Contains(EventTypes, t) {
+			return nil, fmt.Errorf("unknown event type %q, expected one of %s", t, strings.Join(EventTypes, ", "))
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	s := &Subscription{URL: rawURL, EventTypes: eventTypes, Secret: hex.EncodeToString(secret), IsActive: true}
+
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if err = db.QueryRow("set nocount on; exec [spcWebhookSubscriptionInsert] ?, ?, ?",
+		s.URL,
+		strings.Join(s.EventTypes, ","),
+		s.Secret).Scan(&s.ID, &s.CreatedTime); err != nil {
+		return nil, fmt.Errorf("spcWebhookSubscriptionInsert failed: %s", err)
+	}
+
+	return s, nil
+}
+
+// Unsubscribe . . .
+func Unsubscribe(id int64) error {
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("set nocount off; exec [spcWebhookSubscriptionDelete] ?", id)
+	if err != nil {
+		return fmt.Errorf("spcWebhookSubscriptionDelete failed: %s", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetSubscriptions returns the active subscriptions. Secrets are left out unless withSecrets is set.
+func GetSubscriptions(withSecrets bool) ([]*Subscription, error) {
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("set nocount on; exec [spcWebhookSubscriptionsGet]")
+	if err != nil {
+		return nil, fmt.Errorf("spcWebhookSubscriptionsGet Query failed: %s", err)
+	}
+	defer rows.Close()
+
+	subscriptions := []*Subscription{}
+	for rows.Next() {
+		s := &Subscription{}
+		var eventTypes string
+		if err = rows.Scan(
+			&s.ID,
+			&s.URL,
+			&eventTypes,
+			&s.Secret,
+			&s.IsActive,
+			&s.CreatedTime); err != nil {
+			return nil, fmt.Errorf("spcWebhookSubscriptionsGet Query Scan failed: %s", err)
+		}
+		s.EventTypes = strings.Split(eventTypes, ",")
+		if !withSecrets {
+			s.Secret = ""
+		}
+		subscriptions = append(subscriptions, s)
+	}
+
+	return subscriptions, nil
+}
+
+// GetDeliveries returns the delivery log of a subscription, newest first, optionally only those with status.
+// Passing StatusDead lists the dead letters.
+func GetDeliveries(subscriptionID int64, status string, limit int) ([]*Delivery, error) {
+	if status != "" && status != StatusPending && status != StatusDelivered && status != StatusDead {
+		return nil, fmt.Errorf("unknown status %q", status)
+	}
+
+	db, err := data.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("set nocount on; exec [spcWebhookDeliveriesGet] ?, ?, ?", subscriptionID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("spcWebhookDeliveriesGet Query failed: %s", err)
+	}
+	defer rows.Close()
+
+	deliveries := []*Delivery{}
+	for rows.Next() {
+		d := &Delivery{}
+		if err = rows.Scan(
+			&d.ID,
+			&d.SubscriptionID,
+			&d.EventType,
+			&d.EventID,
+			&d.Status,
+			&d.Attempts,
+			&d.NextAttemptTime,
+			&d.ResponseStatus,
+			&d.LastError,
+			&d.CreatedTime,
+			&d.UpdatedTime); err != nil {
+			return nil, fmt.Errorf("spcWebhookDeliveriesGet Query Scan failed: %s", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver puts a dead delivery back in the queue with its attempts reset.
+func Redeliver(deliveryID int64) error {
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec("set nocount off; exec [spcWebhookDeliveryRequeue] ?", deliveryID)
+	if err != nil {
+		return fmt.Errorf("spcWebhookDeliveryRequeue failed: %s", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Sign returns the SignatureHeader value for body sent at timestamp. Receivers recompute it to verify a delivery.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
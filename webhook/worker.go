@@ -0,0 +1,283 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/wilsonelectronics/productsapi/changefeed"
+	"github.com/wilsonelectronics/productsapi/data"
+	"github.com/wilsonelectronics/productsapi/strslice"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is moved to the dead-letter list.
+	MaxAttempts = 8
+
+	fanOutBatchSize   = 500
+	deliveryBatchSize = 100
+	firstRetryDelay   = 30 * time.Second
+	maxRetryDelay     = 6 * time.Hour
+	requestTimeout    = 10 * time.Second
+	maxErrorLength    = 500
+)
+
+var client = &http.Client{Timeout: requestTimeout}
+
+// Payload is the JSON body POSTed to subscribers.
+type Payload struct {
+	Type  string            `json:"type"`
+	Event *changefeed.Event `json:"event"`
+}
+
+type dueDelivery struct {
+	id        int64
+	url       string
+	secret    string
+	eventType string
+	payload   []byte
+	attempts  int
+}
+
+// Run turns new change feed events into deliveries and sends the deliveries that are due, every interval
+// until ctx is done. Several instances may run at once; each event is fanned out once.
+func Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			more, err := fanOut()
+			if err != nil {
+				log.Printf("webhook fan out failed: %s", err)
+			}
+			if !more || err != nil {
+				break
+			}
+		}
+		if err := deliverDue(ctx); err != nil {
+			log.Printf("webhook delivery failed: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fanOut queues a delivery per subscription for the next batch of change feed events. more is true when
+// further events are waiting.
+func fanOut() (more bool, err error) {
+	db, err := data.GetDB()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	var cursor int64
+	if err = db.QueryRow("set nocount on; exec [spcWebhookCursorGet]").Scan(&cursor); err != nil {
+		return false, fmt.Errorf("spcWebhookCursorGet failed: %s", err)
+	}
+
+	page, err := changefeed.Since(cursor, fanOutBatchSize)
+	if err != nil || len(page.Events) == 0 {
+		return false, err
+	}
+
+	subscriptions, err := GetSubscriptions(false)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Moving the cursor only from the value read above means a concurrent worker that got there first makes
+	// this batch a no-op instead of a duplicate.
+	result, err := tx.Exec("set nocount off; exec [spcWebhookCursorSet] ?, ?", cursor, page.NextCursor)
+	if err != nil {
+		return false, fmt.Errorf("spcWebhookCursorSet failed: %s", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	for _, e := range page.Events {
+		for _, eventType := range eventTypesOf(e) {
+			payload, err := json.Marshal(&Payload{Type: eventType, Event: e})
+			if err != nil {
+				return false, err
+			}
+			for _, s := range subscriptions {
+				if !strslice.Contains(s.EventTypes, eventType) {
+					continue
+				}
+				if _, err = tx.Exec("set nocount on; exec [spcWebhookDeliveryInsert] ?, ?, ?, ?",
+					s.ID,
+					eventType,
+					e.ID,
+					string(payload)); err != nil {
+					return false, fmt.Errorf("spcWebhookDeliveryInsert failed: %s", err)
+				}
+			}
+		}
+	}
+
+	return page.HasMore, tx.Commit()
+}
+
+// eventTypesOf maps a change feed event to the webhook events it triggers.
+func eventTypesOf(e *changefeed.Event) []string {
+	switch e.Type {
+	case changefeed.ProductDeleted:
+		return []string{ProductDeactivated}
+	case changefeed.CategoryMembershipChanged:
+		return []string{CategoryMembershipChanged}
+	case changefeed.ProductUpdated:
+		types := []string{ProductUpdated}
+		for _, c := range e.Changes {
+			switch {
+			case c.Field == "details.price":
+				types = append(types, PriceChanged)
+			case c.Field == "details.isActive" && c.Old == true && c.New == false:
+				types = append(types, ProductDeactivated)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// deliverDue sends the deliveries whose next attempt is due. spcWebhookDeliveriesDueGet leases the rows it
+// returns, so other workers skip them while they are being sent.
+func deliverDue(ctx context.Context) error {
+	db, err := data.GetDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("set nocount on; exec [spcWebhookDeliveriesDueGet] ?, ?", deliveryBatchSize, int(2*requestTimeout/time.Second))
+	if err != nil {
+		return fmt.Errorf("spcWebhookDeliveriesDueGet Query failed: %s", err)
+	}
+
+	due := []*dueDelivery{}
+	for rows.Next() {
+		d := &dueDelivery{}
+		var payload string
+		if err = rows.Scan(
+			&d.id,
+			&d.url,
+			&d.secret,
+			&d.eventType,
+			&payload,
+			&d.attempts); err != nil {
+			rows.Close()
+			return fmt.Errorf("spcWebhookDeliveriesDueGet Query Scan failed: %s", err)
+		}
+		d.payload = []byte(payload)
+		due = append(due, d)
+	}
+	rows.Close()
+
+	for _, d := range due {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		attempts := d.attempts + 1
+		responseStatus, sendErr := send(ctx, d)
+
+		status, nextAttempt, lastError := StatusDelivered, interface{}(nil), ""
+		if sendErr != nil {
+			lastError = truncate(sendErr.Error(), maxErrorLength)
+			if attempts >= MaxAttempts {
+				status = StatusDead
+			} else {
+				status = StatusPending
+				nextAttempt = time.Now().UTC().Add(backoff(attempts))
+			}
+		}
+
+		var responseStatusArg interface{}
+		if responseStatus > 0 {
+			responseStatusArg = responseStatus
+		}
+		if _, err = db.Exec("set nocount on; exec [spcWebhookDeliveryUpdate] ?, ?, ?, ?, ?, ?",
+			d.id,
+			status,
+			attempts,
+			nextAttempt,
+			responseStatusArg,
+			lastError); err != nil {
+			return fmt.Errorf("spcWebhookDeliveryUpdate failed: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// send POSTs the payload of d. Any response other than 2xx counts as a failure.
+func send(ctx context.Context, d *dueDelivery) (responseStatus int, err error) {
+	req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewReader(d.payload))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, d.eventType)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(d.secret, timestamp, d.payload))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorLength))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("%s: %s", res.Status, body)
+	}
+	return res.StatusCode, nil
+}
+
+// backoff doubles the wait after each failed attempt, starting at firstRetryDelay and capped at maxRetryDelay.
+func backoff(attempts int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+	return delay
+}
+
+// truncate cuts s to at most n bytes, backing off to the start of a rune so a multi-byte character is
+// not split.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}